@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CHANGE DETECTION
+// ============================================================================
+
+// printDiff lists the pages new, changed and removed between two runs,
+// as text or as CSV.
+func printDiff(db *gorm.DB, w io.Writer, oldRunID, newRunID string, asCSV bool) error {
+	changes, unchanged, err := storage.DiffRuns(db, oldRunID, newRunID)
+	if err != nil {
+		return err
+	}
+
+	status := func(code int) string {
+		if code == 0 {
+			return "-"
+		}
+		return fmt.Sprint(code)
+	}
+
+	if asCSV {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"change", "url", "old_status", "new_status"})
+		for _, c := range changes {
+			cw.Write([]string{c.Status, c.URL, status(c.OldStatus), status(c.NewStatus)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Status]++
+		if c.OldStatus != c.NewStatus {
+			fmt.Fprintf(w, "%-9s  %s  (%s -> %s)\n", c.Status, c.URL, status(c.OldStatus), status(c.NewStatus))
+		} else {
+			fmt.Fprintf(w, "%-9s  %s\n", c.Status, c.URL)
+		}
+	}
+	fmt.Fprintf(w, "%s -> %s: %d new, %d changed, %d unchanged, %d removed\n", oldRunID, newRunID,
+		counts[storage.ChangeNew], counts[storage.ChangeChanged], unchanged, counts[storage.ChangeRemoved])
+	return nil
+}
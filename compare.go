@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"crawl-guardian.com/crawler"
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// SITE COMPARISON
+// ============================================================================
+
+// crawlForComparison crawls every -compare seed into its own run, tagged
+// <run>-<host>, and returns the run IDs in seed order.
+func crawlForComparison(ctx context.Context, db *gorm.DB) ([]string, error) {
+	base := config.Config
+
+	var runIDs []string
+	for _, seed := range config.Compare {
+		host := seed
+		if u, err := url.Parse(seed); err == nil && u.Host != "" {
+			host = u.Host
+		}
+
+		cfg := base
+		cfg.SeedURL = seed
+		cfg.RunID = base.RunID + "-" + strings.ReplaceAll(host, ":", "-")
+
+		log.Printf("Crawling %s as run %s", seed, cfg.RunID)
+		c := crawler.New(cfg, storage.New(db), nil)
+		active.Store(c)
+		if _, err := c.Crawl(ctx); err != nil {
+			return runIDs, err
+		}
+		runIDs = append(runIDs, cfg.RunID)
+	}
+	return runIDs, nil
+}
+
+// siteMetrics are the aggregates compared between runs.
+type siteMetrics struct {
+	Pages           int
+	SuccessPages    int
+	AvgTitleLength  float64
+	WithTitle       int
+	WithMeta        int
+	AvgMetaLength   float64
+	WithH1          int
+	WithCanonical   int
+	AvgWordCount    float64
+	ThinPages       int
+	NoindexPages    int
+	RedirectedPages int
+	AvgExternalJS   float64
+	AvgStylesheets  float64
+}
+
+func loadSiteMetrics(db *gorm.DB, runID string) (siteMetrics, error) {
+	var m siteMetrics
+	err := db.Model(&storage.Page{}).Scopes(storage.RunScope(runID)).Select(`
+		COUNT(*) AS pages,
+		SUM(CASE WHEN status_code BETWEEN 200 AND 299 THEN 1 ELSE 0 END) AS success_pages,
+		COALESCE(AVG(CASE WHEN title <> '' THEN LENGTH(title) END), 0) AS avg_title_length,
+		SUM(CASE WHEN title <> '' THEN 1 ELSE 0 END) AS with_title,
+		SUM(CASE WHEN meta_description <> '' THEN 1 ELSE 0 END) AS with_meta,
+		COALESCE(AVG(CASE WHEN meta_description <> '' THEN LENGTH(meta_description) END), 0) AS avg_meta_length,
+		SUM(CASE WHEN h1 <> '' THEN 1 ELSE 0 END) AS with_h1,
+		SUM(CASE WHEN canonical <> '' THEN 1 ELSE 0 END) AS with_canonical,
+		COALESCE(AVG(word_count), 0) AS avg_word_count,
+		SUM(CASE WHEN thin_content THEN 1 ELSE 0 END) AS thin_pages,
+		SUM(CASE WHEN noindex THEN 1 ELSE 0 END) AS noindex_pages,
+		SUM(CASE WHEN final_url <> '' THEN 1 ELSE 0 END) AS redirected_pages,
+		COALESCE(AVG(external_scripts), 0) AS avg_external_js,
+		COALESCE(AVG(stylesheets), 0) AS avg_stylesheets`).
+		Scan(&m).Error
+	return m, err
+}
+
+// printComparison writes one row per metric and one column per run, as
+// an aligned table or as CSV.
+func printComparison(db *gorm.DB, w io.Writer, runIDs []string, asCSV bool) error {
+	metrics := make([]siteMetrics, len(runIDs))
+	for i, runID := range runIDs {
+		m, err := loadSiteMetrics(db, runID)
+		if err != nil {
+			return fmt.Errorf("run %s: %w", runID, err)
+		}
+		metrics[i] = m
+	}
+
+	pct := func(n, total int) string {
+		if total == 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(float64(n)/float64(total)*100, 'f', 1, 64) + "%"
+	}
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', 1, 64) }
+
+	rows := []struct {
+		name  string
+		value func(m siteMetrics) string
+	}{
+		{"pages", func(m siteMetrics) string { return strconv.Itoa(m.Pages) }},
+		{"2xx pages", func(m siteMetrics) string { return pct(m.SuccessPages, m.Pages) }},
+		{"with title", func(m siteMetrics) string { return pct(m.WithTitle, m.Pages) }},
+		{"avg title length", func(m siteMetrics) string { return num(m.AvgTitleLength) }},
+		{"with meta description", func(m siteMetrics) string { return pct(m.WithMeta, m.Pages) }},
+		{"avg meta description length", func(m siteMetrics) string { return num(m.AvgMetaLength) }},
+		{"with h1", func(m siteMetrics) string { return pct(m.WithH1, m.Pages) }},
+		{"with canonical", func(m siteMetrics) string { return pct(m.WithCanonical, m.Pages) }},
+		{"avg word count", func(m siteMetrics) string { return num(m.AvgWordCount) }},
+		{"thin content", func(m siteMetrics) string { return pct(m.ThinPages, m.Pages) }},
+		{"noindex", func(m siteMetrics) string { return pct(m.NoindexPages, m.Pages) }},
+		{"redirected", func(m siteMetrics) string { return pct(m.RedirectedPages, m.Pages) }},
+		{"avg external scripts", func(m siteMetrics) string { return num(m.AvgExternalJS) }},
+		{"avg stylesheets", func(m siteMetrics) string { return num(m.AvgStylesheets) }},
+	}
+
+	header := append([]string{"metric"}, runIDs...)
+	record := func(i int) []string {
+		r := rows[i]
+		fields := []string{r.name}
+		for _, m := range metrics {
+			fields = append(fields, r.value(m))
+		}
+		return fields
+	}
+
+	if asCSV {
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for i := range rows {
+			cw.Write(record(i))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i := range rows {
+		fmt.Fprintln(tw, strings.Join(record(i), "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"crawl-guardian.com/crawler"
+)
+
+// ============================================================================
+// CONFIGURATION
+// ============================================================================
+
+// options are the crawl settings plus those of the command line alone:
+// the modes that report on stored runs instead of crawling, and the
+// health check server.
+type options struct {
+	crawler.Config
+
+	ConfigFile string
+	Inspect    bool
+	Expect     string
+	ListCrawls bool
+
+	Reports          []string
+	ReportOnly       bool
+	HTMLReport       string
+	StatsHistory     string
+	CSVOutput        bool
+	Compare          []string
+	CanonicalFetch   bool
+	CompareRuns      []string
+	Diff             []string
+	Export           string
+	ExportOut        string
+	ExportLinks      bool
+	ExportDuplicates bool
+
+	Listen        string
+	DebugRuntime  time.Duration
+	ShutdownGrace time.Duration
+}
+
+var config options
+
+func parseFlags() options {
+	var c options
+	crawler.RegisterFlags(flag.CommandLine, &c.Config)
+	registerFlags(flag.CommandLine, &c)
+	flag.Parse()
+
+	if c.ConfigFile != "" {
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+			for alias, name := range crawler.FlagAliases {
+				if f.Name == alias || f.Name == name {
+					set[alias], set[name] = true, true
+				}
+			}
+		})
+		if err := crawler.ApplyConfigFile(flag.CommandLine, c.ConfigFile, set); err != nil {
+			fmt.Fprintln(flag.CommandLine.Output(), err)
+			os.Exit(2)
+		}
+	}
+
+	if c.HMACKey == "" {
+		c.HMACKey = os.Getenv("CRAWLER_HMAC_KEY")
+	}
+
+	if c.Resume != "" {
+		if c.RunID != "" && c.RunID != c.Resume {
+			fmt.Fprintln(flag.CommandLine.Output(), "-resume and -tag name different runs")
+			os.Exit(2)
+		}
+		c.RunID = c.Resume
+		c.StreamDiscovery = true
+	}
+	if len(c.Diff) != 0 && len(c.Diff) != 2 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-diff takes two runs, old and new")
+		os.Exit(2)
+	}
+	if c.Export != "" && !slices.Contains(exportFormats, c.Export) {
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid -export %q (want %s)\n", c.Export, strings.Join(exportFormats, ", "))
+		os.Exit(2)
+	}
+	if (c.ExportLinks || c.ExportDuplicates) && (c.ExportOut == "" || c.ExportOut == "-") {
+		fmt.Fprintln(flag.CommandLine.Output(), "-export-links and -export-duplicates need an -export-out file")
+		os.Exit(2)
+	}
+	if err := c.Validate(); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		os.Exit(2)
+	}
+	return c
+}
+
+// registerFlags defines the flags of the command line alone on fs,
+// storing into c. The crawl settings are registered by
+// crawler.RegisterFlags.
+func registerFlags(fs *flag.FlagSet, c *options) {
+	fs.StringVar(&c.ConfigFile, "config", "", "read settings from this YAML or TOML file, keyed by flag name; flags on the command line take precedence")
+	fs.BoolVar(&c.Inspect, "inspect", false, "fetch only -url, print its SEO data as JSON and exit (no database)")
+	fs.StringVar(&c.Expect, "expect", "", "check the pages listed in this JSON expectations file, report mismatches and exit 1 if any (no database)")
+	fs.BoolVar(&c.ListCrawls, "crawls", false, "list the crawls in -db with their number, run ID, start URL and page count, and exit")
+	fs.Func("report", "comma-separated reports to print after the crawl ("+reportNames()+")", crawler.ListFlag(&c.Reports))
+	fs.StringVar(&c.StatsHistory, "stats-history", "", "print the crawl stats history for this start URL from -db and exit")
+	fs.BoolVar(&c.CSVOutput, "csv", false, "write -stats-history, comparisons, -diff and the broken-links report as CSV")
+	fs.BoolVar(&c.CanonicalFetch, "canonical-fetch", false, "let the canonical-targets report fetch canonical targets that weren't crawled")
+	fs.Func("compare", "comma-separated seed URLs to crawl one after another, each into its own run (<tag>-<host>), then print a side-by-side comparison", crawler.ListFlag(&c.Compare))
+	fs.Func("compare-runs", "with -report-only, print a side-by-side comparison of these comma-separated runs or crawl numbers", crawler.ListFlag(&c.CompareRuns))
+	fs.Func("diff", "print the pages new, changed (visible text or status) and removed between two comma-separated runs or crawl numbers in -db and exit", crawler.ListFlag(&c.Diff))
+	fs.StringVar(&c.Export, "export", "", "write the pages of the -tag run or crawl number (default: latest run) in -db as csv or jsonl and exit")
+	fs.StringVar(&c.ExportOut, "export-out", "-", "file -export writes to (- for stdout)")
+	fs.BoolVar(&c.ExportLinks, "export-links", false, "with -export, also write the run's links to <export-out name>-links.<ext>")
+	fs.BoolVar(&c.ExportDuplicates, "export-duplicates", false, "with -export, also write the run's duplicate titles and meta descriptions to <export-out name>-duplicates.<ext>")
+	fs.BoolVar(&c.ReportOnly, "report-only", false, "skip crawling and print -report for the -tag run or crawl number (default: latest run) in -db")
+	fs.StringVar(&c.HTMLReport, "html-report", "", "write a standalone HTML SEO audit (status codes, titles, meta descriptions, h1s, slowest pages, broken links) of the run to this file; with -report-only, of the -tag run")
+	fs.DurationVar(&c.DebugRuntime, "debug-runtime", 0, "log goroutine count, heap usage and GC pauses at this interval, e.g. 10s (0 disables)")
+	fs.StringVar(&c.Listen, "listen", "", "serve /healthz and /livez on this address (e.g. :8080) and keep running after the crawl until SIGINT/SIGTERM")
+	fs.DurationVar(&c.ShutdownGrace, "shutdown-grace", 5*time.Second, "with -listen, how long /healthz reports stopping before the server closes")
+}
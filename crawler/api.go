@@ -0,0 +1,236 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// API CRAWLING
+// ============================================================================
+
+// apiPage is the data available to the -api-body template.
+type apiPage struct {
+	Page   int    // 1-based page number
+	Offset int    // items returned by earlier pages
+	Cursor string // value of -api-next from the previous response
+}
+
+// crawlAPI pages through a JSON endpoint (GraphQL, search APIs and the
+// like), queues the URLs it finds for the HTML workers and stores any
+// records. It stops when a page yields nothing, the cursor runs out,
+// -api-max-pages is reached, maxURLs URLs have been queued or ctx is
+// canceled. API pages are requested like HTML pages are: subject to
+// robots.txt, the host's limits and budget, and retried.
+func (c *Crawler) crawlAPI(ctx context.Context, worklist chan<- crawlTask, maxURLs int, done chan<- bool) {
+	defer func() { done <- true }()
+
+	body, err := template.New("api-body").Parse(c.config.APIBody)
+	if err != nil {
+		slog.Error("invalid -api-body template", "error", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	state := apiPage{Page: 1}
+	total := 0
+
+	for ; state.Page <= c.config.APIMaxPages; state.Page++ {
+		if ctx.Err() != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := body.Execute(&buf, state); err != nil {
+			slog.Error("failed to render -api-body", "page", state.Page, "error", err)
+			return
+		}
+
+		doc, err := c.fetchAPIPage(ctx, c.config.APIURL, buf.Bytes())
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("api request failed", "page", state.Page, "error", err)
+			}
+			return
+		}
+
+		urls := jsonPath(doc, c.config.APIURLPath)
+		queued := 0
+		for _, v := range urls {
+			link, ok := parseSeedURL(fmt.Sprint(v), nil, c.normalizer)
+			if !ok || seen[link] || total >= maxURLs {
+				continue
+			}
+			seen[link] = true
+			// Disallowed URLs don't count towards -max-pages.
+			if allowed, err := c.client.Allowed(ctx, link); err != nil || !allowed {
+				continue
+			}
+			worklist <- crawlTask{URL: link}
+			queued++
+			total++
+		}
+
+		records := jsonPath(doc, c.config.APIRecordPath)
+		if err := c.saveAPIRecords(state.Page, records); err != nil {
+			slog.Error("failed to save api records", "page", state.Page, "error", err)
+		}
+
+		slog.Info("api page crawled", "page", state.Page, "urls", queued, "records", len(records))
+		items := max(len(urls), len(records))
+		if items == 0 {
+			return
+		}
+		if total >= maxURLs {
+			slog.Info("api crawl reached -max-pages", "urls", total)
+			return
+		}
+		state.Offset += items
+
+		if c.config.APINextPath != "" {
+			next := jsonPath(doc, c.config.APINextPath)
+			if len(next) == 0 || next[0] == nil || fmt.Sprint(next[0]) == "" {
+				return
+			}
+			cursor := fmt.Sprint(next[0])
+			if cursor == state.Cursor {
+				return
+			}
+			state.Cursor = cursor
+		}
+	}
+}
+
+// fetchAPIPage sends payload to endpoint through the same request path
+// as pages, and decodes the JSON response.
+func (c *Crawler) fetchAPIPage(ctx context.Context, endpoint string, payload []byte) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	newRequest := func(ctx context.Context, url string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, c.config.APIMethod, url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", c.client.UserAgent())
+		req.Header.Set("Content-Type", c.config.APIContentType)
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}
+	resp, err := c.client.Do(ctx, endpoint, newRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, snippet)
+	}
+
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid json response: %w", err)
+	}
+	return doc, nil
+}
+
+func (c *Crawler) saveAPIRecords(page int, values []any) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	records := make([]storage.APIRecord, 0, len(values))
+	for _, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		records = append(records, storage.APIRecord{
+			RunID:    c.config.RunID,
+			Endpoint: c.config.APIURL,
+			Page:     page,
+			Data:     string(data),
+		})
+	}
+	return c.db.CreateInBatches(&records, 100).Error
+}
+
+// jsonPath evaluates a small JSONPath-like expression against decoded
+// JSON: dot-separated keys, [n] for an array index and [*] for every
+// element, e.g. "data.products[*].url". An empty path matches nothing.
+func jsonPath(doc any, path string) []any {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$.")
+	if path == "" {
+		return nil
+	}
+
+	current := []any{doc}
+	for _, part := range strings.Split(path, ".") {
+		key, indexes := splitPathPart(part)
+
+		var next []any
+		for _, v := range current {
+			if key != "" {
+				obj, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				if v, ok = obj[key]; !ok {
+					continue
+				}
+			}
+			next = append(next, applyIndexes(v, indexes)...)
+		}
+		current = next
+	}
+	return current
+}
+
+// splitPathPart splits "items[*][0]" into "items" and ["*", "0"].
+func splitPathPart(part string) (string, []string) {
+	key, rest, _ := strings.Cut(part, "[")
+	if rest == "" {
+		return key, nil
+	}
+
+	var indexes []string
+	for _, idx := range strings.Split("["+rest, "[") {
+		if idx = strings.TrimSuffix(idx, "]"); idx != "" {
+			indexes = append(indexes, idx)
+		}
+	}
+	return key, indexes
+}
+
+func applyIndexes(v any, indexes []string) []any {
+	values := []any{v}
+	for _, idx := range indexes {
+		var next []any
+		for _, v := range values {
+			arr, ok := v.([]any)
+			if !ok {
+				continue
+			}
+			if idx == "*" {
+				next = append(next, arr...)
+				continue
+			}
+			if i, err := strconv.Atoi(idx); err == nil && i >= 0 && i < len(arr) {
+				next = append(next, arr[i])
+			}
+		}
+		values = next
+	}
+	return values
+}
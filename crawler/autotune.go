@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CONCURRENCY AUTO-TUNING
+// ============================================================================
+
+// concurrencyTuner gates the page requests of a crawl, made by discovery
+// or by the workers, with an AIMD controller: the limit grows by one each interval while error rate and latency stay
+// healthy and is halved as soon as either degrades.
+type concurrencyTuner struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	peak   int // most requests in flight during the interval
+
+	min, max     int
+	maxErrorRate float64
+	maxLatency   time.Duration
+
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+func newConcurrencyTuner(lo, hi int, maxErrorRate float64, maxLatency time.Duration) *concurrencyTuner {
+	lo = max(lo, 1)
+	t := &concurrencyTuner{
+		limit:        lo,
+		min:          lo,
+		max:          max(hi, lo),
+		maxErrorRate: maxErrorRate,
+		maxLatency:   maxLatency,
+	}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Acquire blocks until another request may start.
+func (t *concurrencyTuner) Acquire() {
+	t.mu.Lock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+	t.peak = max(t.peak, t.active)
+	t.mu.Unlock()
+}
+
+func (t *concurrencyTuner) Release() {
+	t.mu.Lock()
+	t.active--
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// Observe feeds one request outcome into the current interval.
+func (t *concurrencyTuner) Observe(latency time.Duration, failed bool) {
+	t.mu.Lock()
+	t.requests++
+	t.latency += latency
+	if failed {
+		t.errors++
+	}
+	t.mu.Unlock()
+}
+
+// adjust closes the current interval and applies the AIMD step.
+func (t *concurrencyTuner) adjust() storage.ConcurrencySample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sample := storage.ConcurrencySample{Requests: t.requests, SampledAt: time.Now()}
+	if t.requests > 0 {
+		sample.ErrorRate = float64(t.errors) / float64(t.requests)
+		sample.AvgLatencyMs = (t.latency / time.Duration(t.requests)).Milliseconds()
+	}
+
+	switch {
+	case t.requests == 0:
+		// no feedback, hold steady
+	case sample.ErrorRate > t.maxErrorRate ||
+		time.Duration(sample.AvgLatencyMs)*time.Millisecond > t.maxLatency:
+		t.limit = max(t.limit/2, t.min)
+	case t.peak >= t.limit:
+		// only grow when the current limit was actually reached
+		t.limit = min(t.limit+1, t.max)
+	}
+
+	t.requests, t.errors, t.latency = 0, 0, 0
+	t.peak = t.active
+	t.cond.Broadcast()
+
+	sample.Limit = t.limit
+	return sample
+}
+
+// run adjusts the limit every interval until stop is closed, saving each
+// sample so the chosen concurrency can be reviewed after the crawl.
+func (t *concurrencyTuner) run(db *gorm.DB, runID string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := t.limit
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sample := t.adjust()
+			sample.RunID = runID
+			if err := db.Create(&sample).Error; err != nil {
+				slog.Error("failed to save concurrency sample", "error", err)
+			}
+			if sample.Limit != last {
+				slog.Info("concurrency adjusted", "from", last, "to", sample.Limit,
+					"error_rate", sample.ErrorRate, "avg_latency_ms", sample.AvgLatencyMs)
+				last = sample.Limit
+			}
+		}
+	}
+}
+
+// requestSlot takes a request slot from the -autotune tuner, waiting for
+// one, and returns the func that gives it back. The func may be called
+// more than once; without -autotune it does nothing.
+func (c *Crawler) requestSlot() func() {
+	if c.tuner == nil {
+		return func() {}
+	}
+	c.tuner.Acquire()
+	return sync.OnceFunc(c.tuner.Release)
+}
+
+// observeRequest feeds the outcome of a page request to the -autotune
+// tuner. Errors, 5xx and 429 responses count as failures.
+func (c *Crawler) observeRequest(fetchTime time.Duration, resp *http.Response, err error) {
+	if c.tuner == nil {
+		return
+	}
+	failed := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	c.tuner.Observe(fetchTime, failed)
+}
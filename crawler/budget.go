@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// PER-HOST REQUEST BUDGETS
+// ============================================================================
+
+// hostBudgets enforces a hard cap on requests per host per window (for
+// example 1000 a day). Windows are aligned to multiples of the window
+// length, so a 24h budget resets at midnight UTC. A host whose budget is
+// spent is paused until its window resets; other hosts are unaffected.
+type hostBudgets struct {
+	mu      sync.Mutex
+	db      *gorm.DB
+	limit   int
+	window  time.Duration
+	budgets map[string]*storage.HostBudget
+	paused  map[string]bool
+}
+
+func newHostBudgets(db *gorm.DB, limit int, window time.Duration) *hostBudgets {
+	return &hostBudgets{
+		db:      db,
+		limit:   limit,
+		window:  window,
+		budgets: make(map[string]*storage.HostBudget),
+		paused:  make(map[string]bool),
+	}
+}
+
+// Wait takes one request from rawURL's host budget, blocking until the
+// window resets when the budget is already spent.
+func (b *hostBudgets) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := u.Host
+
+	for {
+		resetAt, err := b.take(host)
+		if err != nil {
+			return err
+		}
+		if resetAt.IsZero() {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(resetAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("host budget for %s exhausted: %w", host, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// take counts a request against host, or returns when the host's window
+// resets if its budget is spent.
+func (b *hostBudgets) take(host string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	budget, err := b.load(host)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	if window := now.Truncate(b.window); window.After(budget.WindowStart) {
+		budget.WindowStart = window
+		budget.Count = 0
+		if b.paused[host] {
+			slog.Info("host budget reset, resuming", "host", host)
+			delete(b.paused, host)
+		}
+	}
+
+	if budget.Count >= b.limit {
+		resetAt := budget.WindowStart.Add(b.window)
+		if !b.paused[host] {
+			slog.Warn("host budget exhausted, pausing host", "host", host,
+				"requests", budget.Count, "resumes_at", resetAt.Format(time.RFC3339))
+			b.paused[host] = true
+		}
+		return resetAt, nil
+	}
+
+	budget.Count++
+	err = b.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(budget).Error
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to save host budget: %w", err)
+	}
+	return time.Time{}, nil
+}
+
+func (b *hostBudgets) load(host string) (*storage.HostBudget, error) {
+	if budget, ok := b.budgets[host]; ok {
+		return budget, nil
+	}
+
+	budget := &storage.HostBudget{Host: host}
+	err := b.db.Where("host = ?", host).FirstOrInit(budget).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load host budget: %w", err)
+	}
+	b.budgets[host] = budget
+	return budget, nil
+}
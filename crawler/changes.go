@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"log"
+
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// CHANGE DETECTION
+// ============================================================================
+
+// logPageChanges compares the finished run with the previous run from the
+// same start URL, if any, records the pages it no longer has and logs
+// how many pages changed. With -on-recrawl update, UpsertPage already
+// compared each page with the row it overwrote; pages that had no row
+// are new.
+func (c *Crawler) logPageChanges(startURL string) error {
+	db, runID := c.db, c.config.RunID
+	prevRunID, err := storage.PreviousRunID(db, runID, startURL)
+	if err != nil || prevRunID == "" {
+		return err
+	}
+	if c.config.OnRecrawl == storage.RecrawlUpdate {
+		err = db.Model(&storage.Page{}).
+			Where("run_id = ? AND change_status = ''", runID).
+			Update("change_status", storage.ChangeNew).Error
+	} else {
+		err = storage.UpdatePageChanges(db, runID, prevRunID)
+	}
+	if err != nil {
+		return err
+	}
+	removed, err := storage.UpdateRemovedPages(db, runID, prevRunID)
+	if err != nil {
+		return err
+	}
+
+	var counts []struct {
+		ChangeStatus string
+		Pages        int
+	}
+	err = db.Model(&storage.Page{}).
+		Select("change_status, COUNT(*) AS pages").
+		Where("run_id = ?", runID).
+		Group("change_status").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	byStatus := make(map[string]int)
+	for _, c := range counts {
+		byStatus[c.ChangeStatus] = c.Pages
+	}
+	log.Printf("Changes since run %s: %d new, %d changed, %d unchanged, %d removed",
+		prevRunID, byStatus[storage.ChangeNew], byStatus[storage.ChangeChanged], byStatus[storage.ChangeUnchanged], removed)
+	return nil
+}
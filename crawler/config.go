@@ -0,0 +1,371 @@
+package crawler
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// CONFIGURATION
+// ============================================================================
+
+// Config holds the settings of a crawl. Each field is set by the
+// command-line flag registered for it by RegisterFlags; the request
+// settings are those of the fetch package.
+type Config struct {
+	fetch.Config
+
+	SeedURL  string
+	MaxPages int
+	Workers  int
+
+	DBPath string
+	RunID  string
+	Resume string
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBFlushInterval   time.Duration
+	DBMaxBatch        int
+	DBBatch           int
+
+	StatsInterval time.Duration
+
+	NormalizePaths    bool
+	NormalizeEncoding bool
+	NormalizeQuery    bool
+	StripParams       []string
+	FoldScheme        bool
+	FoldTrailingSlash bool
+
+	MetaWatchlist []string
+
+	ListResources bool
+	AnchorDetails bool
+
+	Classify      bool
+	PageTypeRules []parser.PageTypeRule
+
+	ValidateStructuredData bool
+	StructuredDataRules    string
+	ThinWords              int
+	HeadingWords           int
+	HeadingMinWords        int
+
+	RedirectHopsWarn int
+
+	OutDir  string
+	OutHTML bool
+
+	HashGate   bool
+	OnRecrawl  string
+	Revalidate bool
+
+	// Quiet turns the live progress display off.
+	Quiet bool
+
+	HostBudget       int
+	HostBudgetWindow time.Duration
+
+	// Concurrency auto-tuning
+	AutoTune             bool
+	MinWorkers           int
+	MaxWorkers           int
+	AutoTuneInterval     time.Duration
+	AutoTuneMaxErrorRate float64
+	AutoTuneMaxLatency   time.Duration
+
+	// CSV seeding (Search Console / analytics exports)
+	SeedCSV    string
+	CSVColumn  string
+	CSVBaseURL string
+
+	// Sitemap seeding
+	SitemapURL       string
+	WithSitemap      bool
+	Since            time.Time
+	IncludeNoLastMod bool
+
+	// JSON API crawling
+	APIURL         string
+	APIMethod      string
+	APIBody        string
+	APIContentType string
+	APIURLPath     string
+	APIRecordPath  string
+	APINextPath    string
+	APIMaxPages    int
+
+	// Streaming discovery with a disk-backed frontier
+	StreamDiscovery  bool
+	DiscoveryWorkers int
+
+	// Scope
+	Scope             string
+	ScopeAllowDomains []string
+	ScopeAllowRels    []string
+	Subtree           bool
+	MaxHosts          int
+	MaxDepth          int
+	Include           []string
+	Exclude           []string
+
+	// Robots directives on pages and links
+	RespectNofollow bool
+	FollowNoindex   bool
+
+	// Trap avoidance
+	EmptyStreak int
+	EmptyWords  int
+
+	TrapRepeat    int
+	TrapMaxParams int
+}
+
+// Validate reports the first setting that can't work, naming its flag.
+func (c Config) Validate() error {
+	if c.MaxPages < 1 || c.Workers < 1 {
+		return errors.New("-max-pages and -workers must be at least 1")
+	}
+	if !slices.Contains(ScopeModes, c.Scope) {
+		return fmt.Errorf("invalid -scope %q (want %s)", c.Scope, strings.Join(ScopeModes, ", "))
+	}
+	if !slices.Contains(fetch.ProxyRotations, c.ProxyRotation) {
+		return fmt.Errorf("invalid -proxy-rotation %q (want %s)", c.ProxyRotation, strings.Join(fetch.ProxyRotations, ", "))
+	}
+	if !slices.Contains(storage.RecrawlModes, c.OnRecrawl) {
+		return fmt.Errorf("invalid -on-recrawl %q (want %s)", c.OnRecrawl, strings.Join(storage.RecrawlModes, ", "))
+	}
+	if c.APIURL != "" && c.APIURLPath == "" && c.APIRecordPath == "" {
+		return errors.New("-api-url needs -api-urls and/or -api-records")
+	}
+	return fetch.CheckClientProfile(c.ClientProfile)
+}
+
+// Normalizer returns the URL normalization of the -normalize-* and
+// -fold-* flags.
+func (c Config) Normalizer() parser.Normalizer {
+	return parser.Normalizer{
+		Paths:             c.NormalizePaths,
+		Encoding:          c.NormalizeEncoding,
+		Query:             c.NormalizeQuery,
+		StripParams:       c.StripParams,
+		FoldScheme:        c.FoldScheme,
+		FoldTrailingSlash: c.FoldTrailingSlash,
+	}
+}
+
+// DefaultConfig returns the configuration used when no flags are given,
+// as a starting point for crawls started from Go code.
+func DefaultConfig() Config {
+	var c Config
+	RegisterFlags(flag.NewFlagSet("crawler", flag.ContinueOnError), &c)
+	return c
+}
+
+// FlagAliases maps alternative flag names to the flags they stand for.
+var FlagAliases = map[string]string{"seed": "url", "name": "tag"}
+
+// RegisterFlags defines the command-line flag of every setting on fs,
+// storing into c.
+func RegisterFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.SeedURL, "url", "http://books.toscrape.com", "URL to start crawling from")
+	fs.StringVar(&c.SeedURL, "seed", "http://books.toscrape.com", "alias for -url")
+	fs.IntVar(&c.MaxPages, "max-pages", 100, "stop discovering after this many pages")
+	fs.IntVar(&c.Workers, "workers", 5, "number of scraping workers (with -autotune, -max-workers is used instead)")
+	fs.StringVar(&c.DBPath, "db", storage.DefaultDB, "SQLite database file, :memory:, or a postgres:// or mysql:// URL; every run is kept in it, numbered as a crawl")
+	fs.IntVar(&c.DBMaxOpenConns, "db-max-open-conns", 0, "maximum open database connections (0 = 1 for SQLite, which serializes writes; 10 for Postgres)")
+	fs.IntVar(&c.DBMaxIdleConns, "db-max-idle-conns", 0, "maximum idle database connections (0 = same as -db-max-open-conns)")
+	fs.DurationVar(&c.DBConnMaxLifetime, "db-conn-max-lifetime", 0, "close database connections after this long (0 = never)")
+	fs.DurationVar(&c.DBFlushInterval, "db-flush-interval", 0, "queue scraped pages and save them in one transaction per interval, smoothing disk I/O (0 = save each page immediately)")
+	fs.IntVar(&c.DBMaxBatch, "db-max-batch", 50, "with -db-flush-interval, save at most this many pages per flush; workers wait when pages arrive faster")
+	fs.IntVar(&c.DBBatch, "db-batch", 0, "save scraped pages from a background writer, in one transaction per this many pages or per -db-flush-interval (default 2s), whichever comes first (0 = off)")
+	fs.StringVar(&c.RunID, "tag", "", "name of this run, stored on every page and stats row (default: generated run ID)")
+	fs.StringVar(&c.RunID, "name", "", "alias for -tag")
+	fs.StringVar(&c.Resume, "resume", "", "resume the interrupted -stream crawl with this run ID from its stored frontier (implies -stream)")
+	fs.DurationVar(&c.StatsInterval, "stats-interval", 30*time.Second, "save partial crawl stats this often while crawling (0 = only at the end)")
+	fs.StringVar(&c.UserAgent, "user-agent", "", "User-Agent header sent with requests (default: rotate through built-in browser UAs)")
+	fs.Func("header", "extra request header as \"Name: value\", e.g. \"Authorization: Bearer ...\" (repeatable, overrides -client-profile headers)", func(v string) error {
+		h, err := fetch.ParseHeader(v)
+		if err != nil {
+			return err
+		}
+		c.Headers = append(c.Headers, h)
+		return nil
+	})
+	fs.StringVar(&c.CookieFile, "cookies", "", "Netscape cookies.txt file (browser export, curl -c) to start the crawl with; cookies the site sets are kept too")
+	fs.StringVar(&c.LoginURL, "login-url", "", "login page whose form is filled with -login-field values and submitted before crawling; the session cookies are used for the crawl")
+	fs.Func("login-field", "login form field as name=value, $VARS expanded from the environment, e.g. 'password=$SITE_PASSWORD' (repeatable)", func(v string) error {
+		c.LoginFields = append(c.LoginFields, v)
+		return nil
+	})
+	fs.StringVar(&c.LoginExpired, "login-expired", "", "regexp matching pages that show the session expired, to sign in again and refetch them (redirects to -login-url are always caught)")
+	fs.BoolVar(&c.Robots, "robots", true, "obey robots.txt Disallow/Allow rules and Crawl-delay, matching groups against -robots-ua (cached per host)")
+	fs.StringVar(&c.RobotsUA, "robots-ua", "crawl-guardian", "product token matched against robots.txt user-agent groups, independent of -user-agent")
+	fs.StringVar(&c.ClientProfile, "client-profile", "go", "request profile: go (plain Go client) or browser (desktop browser request headers; authorized crawling only)")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", 10*time.Second, "time limit for each request, redirects and reading the body included")
+	fs.IntVar(&c.MaxIdleConns, "max-idle-conns", 100, "keep-alive connections kept open across all hosts (0 = no limit)")
+	fs.IntVar(&c.MaxIdleConnsPerHost, "max-idle-conns-per-host", 10, "keep-alive connections kept open per host; set it to at least -workers for a single-host crawl")
+	fs.DurationVar(&c.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "close keep-alive connections idle for this long")
+	fs.BoolVar(&c.HTTP2, "http2", true, "negotiate HTTP/2 with servers that offer it (-http2=false forces HTTP/1.1)")
+	fs.BoolVar(&c.NormalizePaths, "normalize-paths", true, "resolve ./.. segments and collapse duplicate slashes in URL paths before deduplication")
+	fs.BoolVar(&c.NormalizeEncoding, "normalize-encoding", true, "percent-encode spaces and non-ASCII, uppercase escapes and decode escaped unreserved characters in URL paths and queries")
+	fs.BoolVar(&c.NormalizeQuery, "normalize-query", true, "drop utm_*, gclid, fbclid and other tracking parameters and sort the remaining query parameters before deduplication")
+	fs.Func("strip-params", "comma-separated query parameters to drop as well with -normalize-query, e.g. sessionid,ref", func(v string) error {
+		if err := ListFlag(&c.StripParams)(v); err != nil {
+			return err
+		}
+		for i, p := range c.StripParams {
+			c.StripParams[i] = strings.ToLower(p)
+		}
+		return nil
+	})
+	fs.BoolVar(&c.FoldScheme, "fold-scheme", false, "treat http:// URLs as their https:// form, crawling each page once over https")
+	fs.BoolVar(&c.FoldTrailingSlash, "fold-trailing-slash", false, "treat /a/ and /a as the same URL, keeping the form without the slash")
+	fs.Func("meta", "comma-separated meta tag names or properties to store per page, e.g. author,keywords,og:type (matched case-insensitively against name, property and http-equiv)", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				c.MetaWatchlist = append(c.MetaWatchlist, name)
+			}
+		}
+		return nil
+	})
+	fs.BoolVar(&c.ListResources, "resources", false, "store every script and stylesheet per page in the resources table (counts are always kept)")
+	fs.BoolVar(&c.AnchorDetails, "anchor-details", false, "store every in-page #anchor link per page in the anchor_links table (counts are always kept)")
+	fs.BoolVar(&c.Classify, "classify", false, "classify pages by type from their JSON-LD @type and print a count per type after the crawl")
+	fs.Func("page-type", "classify URLs matching a regexp as a page type, e.g. product=/p/[0-9]+ (repeatable, first match wins, implies -classify)", func(v string) error {
+		rule, err := parser.ParsePageTypeRule(v)
+		if err != nil {
+			return err
+		}
+		c.PageTypeRules = append(c.PageTypeRules, rule)
+		return nil
+	})
+	fs.BoolVar(&c.ValidateStructuredData, "validate-structured-data", false, "check JSON-LD items for the fields their type requires (Product needs name and offers, Article needs headline, ...)")
+	fs.StringVar(&c.StructuredDataRules, "structured-data-rules", "", "JSON file of required fields per type, e.g. {\"Product\": [\"name\", \"offers.price\"]}, replacing the built-in rule for each listed type (implies -validate-structured-data)")
+	fs.IntVar(&c.ThinWords, "thin-words", 100, "flag successful pages with fewer visible words than this as thin content (0 disables)")
+	fs.IntVar(&c.HeadingWords, "heading-words", 30, "flag pages with a heading for fewer than this many visible words as too heading-dense (0 disables)")
+	fs.IntVar(&c.HeadingMinWords, "heading-min-words", 300, "flag pages with at least this many visible words and no h1-h6 (0 disables)")
+	fs.IntVar(&c.RedirectHopsWarn, "redirect-hops-warn", 2, "flag pages reached through more redirects than this as LongRedirectChain (0 disables)")
+	fs.IntVar(&c.MaxRedirects, "max-redirects", 10, "stop following a redirect chain after this many hops and store its last redirect as the page (0 = no limit; loops are always cut)")
+	fs.StringVar(&c.OutDir, "out-dir", "", "also write each page's SEO data as JSON into a directory tree mirroring the URL paths")
+	fs.BoolVar(&c.OutHTML, "out-html", false, "with -out-dir, store the raw HTML next to each JSON file")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", 10<<20, "stop reading a response after this many bytes, parsing what was read and marking the page truncated (0 = no limit)")
+	fs.Int64Var(&c.SkipLargerThan, "skip-larger-than", 0, "skip pages whose Content-Length header exceeds this many bytes without reading the body, recording them as too-large (0 disables)")
+	fs.BoolVar(&c.HashGate, "hash-gate", false, "copy pages whose content hash matches their latest earlier run instead of extracting them again, and log changed vs unchanged counts")
+	fs.StringVar(&c.OnRecrawl, "on-recrawl", storage.RecrawlHistory, "how pages of a URL crawled before are stored: history (a row per run, earlier runs kept) or update (one row per URL, overwritten in place by each run)")
+	fs.BoolVar(&c.Revalidate, "revalidate", false, "send each page's ETag and Last-Modified from its latest earlier run in -db, and copy pages answering 304 Not Modified without downloading them")
+	fs.Int64Var(&c.ByteBudget, "byte-budget", 0, "stop requesting once this many body bytes have been downloaded in total (0 = no limit)")
+	fs.DurationVar(&c.WarmupDelay, "warmup-delay", 0, "fetch robots.txt and wait this long before the first page request to each new host (0 disables)")
+	fs.DurationVar(&c.HostDelay, "host-delay", 0, "minimum spacing of requests to each host, shared by all workers, e.g. 500ms; a robots.txt Crawl-delay overrides it (0 = only Crawl-delay)")
+	fs.IntVar(&c.HostBurst, "host-burst", 1, "requests a host may get back to back before -host-delay applies")
+	fs.IntVar(&c.HostConcurrency, "host-concurrency", 2, "requests in flight to each host at once, whatever -workers is (0 = no limit)")
+	fs.IntVar(&c.MaxAttempts, "max-attempts", 3, "requests per URL before giving up on connection errors, timeouts, 429 and 5xx (1 disables retries)")
+	fs.DurationVar(&c.RetryBackoff, "retry-backoff", 500*time.Millisecond, "wait before the first retry, doubled for each further one, with jitter")
+	fs.DurationVar(&c.RetryMaxBackoff, "retry-max-backoff", 10*time.Second, "longest wait between retries, not counting Retry-After cooldowns")
+	fs.DurationVar(&c.MaxCooldown, "max-cooldown", 5*time.Minute, "longest Retry-After on a 429 or 503 that pauses the host and retries; longer ones are treated as a failure")
+	fs.StringVar(&c.HMACKey, "hmac-key", "", "sign every request with HMAC-SHA256 over method, path and timestamp using this key (default: $CRAWLER_HMAC_KEY)")
+	fs.StringVar(&c.HMACHeader, "hmac-header", "X-Signature", "header carrying the -hmac-key signature")
+	fs.StringVar(&c.HMACTimestampHeader, "hmac-timestamp-header", "X-Timestamp", "header carrying the signed unix timestamp")
+	fs.Func("proxies", "comma-separated proxy URLs (http://host:port, socks5://host:port) to rotate requests through", ListFlag(&c.Proxies))
+	fs.StringVar(&c.ProxyFile, "proxy-file", "", "file of proxy URLs to rotate through, one per line (# comments), added to -proxies")
+	fs.StringVar(&c.ProxyRotation, "proxy-rotation", fetch.ProxyRoundRobin, "how requests are spread over the proxies: round-robin, or sticky (each host keeps its proxy while it is in rotation)")
+	fs.IntVar(&c.ProxyFailThreshold, "proxy-fail-threshold", 3, "take a proxy out of rotation after this many connection errors in a row")
+	fs.DurationVar(&c.ProxyRetest, "proxy-retest", time.Minute, "send one trial request through a benched proxy after this long")
+	fs.BoolVar(&c.Render, "render", false, "replace the HTML of successful pages with the DOM headless Chrome renders from them, for JavaScript-heavy sites")
+	fs.Func("render-pattern", "render only pages matching this regexp, or robots.txt-style glob:/path* pattern (repeatable)", patternFlag(&c.RenderPatterns))
+	fs.StringVar(&c.RenderChrome, "render-chrome", "", "Chrome or Chromium binary used by -render (default: looked up in PATH)")
+	fs.DurationVar(&c.RenderWait, "render-wait", 5*time.Second, "virtual time a rendered page gets to run its scripts after loading, before its DOM is taken")
+	fs.DurationVar(&c.RenderTimeout, "render-timeout", 30*time.Second, "give up rendering a page after this long and keep its plain HTML")
+	fs.IntVar(&c.RenderConcurrency, "render-concurrency", 2, "pages Chrome renders at the same time, each in its own tab")
+	fs.BoolVar(&c.TraceTimings, "trace-timings", false, "also record DNS, connect and TLS milliseconds per page (time to first byte and total response time are always recorded)")
+	fs.BoolVar(&c.RecordEgress, "record-egress", false, "store the local IP and proxy each page was fetched through, and look up the run's public IP from -egress-echo-url")
+	fs.StringVar(&c.EgressEchoURL, "egress-echo-url", "https://api.ipify.org", "service answering with the caller's IP as plain text, used by -record-egress")
+	fs.BoolVar(&c.Quiet, "quiet", false, "no live progress display, and only warnings and errors in the log besides the final summary; the display is also off when stderr isn't a terminal")
+	fs.IntVar(&c.HostBudget, "host-budget", 0, "hard cap on requests per host per -host-budget-window, persisted in -db (0 disables)")
+	fs.DurationVar(&c.HostBudgetWindow, "host-budget-window", 24*time.Hour, "length of the -host-budget window; windows are aligned, so 24h resets at midnight UTC")
+	fs.BoolVar(&c.AutoTune, "autotune", false, "adjust the number of active workers from error rate and latency (AIMD)")
+	fs.IntVar(&c.MinWorkers, "min-workers", 2, "lower bound for -autotune")
+	fs.IntVar(&c.MaxWorkers, "max-workers", 20, "upper bound for -autotune")
+	fs.DurationVar(&c.AutoTuneInterval, "autotune-interval", 5*time.Second, "how often -autotune re-evaluates the worker limit")
+	fs.Float64Var(&c.AutoTuneMaxErrorRate, "autotune-max-error-rate", 0.05, "error rate (0-1) above which -autotune halves concurrency")
+	fs.DurationVar(&c.AutoTuneMaxLatency, "autotune-max-latency", 3*time.Second, "average latency above which -autotune halves concurrency")
+	fs.StringVar(&c.SeedCSV, "seed-csv", "", "seed the worklist from a CSV export (Search Console, analytics) instead of discovering links")
+	fs.StringVar(&c.CSVColumn, "csv-column", "", "CSV column holding the URLs: header name or 1-based number (default: auto-detect)")
+	fs.StringVar(&c.CSVBaseURL, "csv-base", "", "base URL used to resolve relative paths in the CSV (e.g. analytics \"Page path\" exports)")
+	fs.StringVar(&c.SitemapURL, "sitemap", "", "seed the worklist from this sitemap (or sitemap index, gzipped or not) instead of discovering links")
+	fs.BoolVar(&c.WithSitemap, "with-sitemap", false, "discover links as usual, and also crawl the URLs of -sitemap, or of /sitemap.xml on the seed's host")
+	fs.Func("since", "with -sitemap, only crawl URLs whose lastmod is after this date (YYYY-MM-DD or RFC 3339)", func(v string) error {
+		t, ok := parseLastMod(v)
+		if !ok {
+			return fmt.Errorf("invalid date %q", v)
+		}
+		c.Since = t
+		return nil
+	})
+	fs.BoolVar(&c.IncludeNoLastMod, "include-no-lastmod", true, "with -since, still crawl sitemap URLs that have no lastmod")
+	fs.StringVar(&c.APIURL, "api-url", "", "crawl a paginated JSON API endpoint instead of HTML links")
+	fs.StringVar(&c.APIMethod, "api-method", "POST", "HTTP method for -api-url")
+	fs.StringVar(&c.APIBody, "api-body", "", "request body template for -api-url; {{.Page}}, {{.Offset}} and {{.Cursor}} are filled in per page")
+	fs.StringVar(&c.APIContentType, "api-content-type", "application/json", "Content-Type of -api-body")
+	fs.StringVar(&c.APIURLPath, "api-urls", "", "path to page URLs in the response, e.g. data.products[*].url; they are scraped as HTML")
+	fs.StringVar(&c.APIRecordPath, "api-records", "", "path to items stored as raw JSON records, e.g. data.products[*]")
+	fs.StringVar(&c.APINextPath, "api-next", "", "path to the next-page cursor; without it pages are numbered")
+	fs.IntVar(&c.APIMaxPages, "api-max-pages", 50, "maximum number of API pages to request")
+	fs.BoolVar(&c.StreamDiscovery, "stream", false, "keep the discovery frontier in the database instead of memory, keeping memory flat on very large sites and allowing -resume")
+	fs.IntVar(&c.DiscoveryWorkers, "discovery-workers", 0, "goroutines fetching pages for discovery and queueing their links (0 = as many as -workers, or -max-workers with -autotune)")
+	fs.StringVar(&c.Scope, "scope", ScopeAny, "which discovered links to follow: any, host (the seed's host only), subdomains (the seed's host and its subdomains) or domain (the seed's registered domain)")
+	fs.Func("include", "only follow discovered URLs matching this regexp, or robots.txt-style glob:/path* pattern (repeatable)", patternFlag(&c.Include))
+	fs.Func("exclude", "don't follow discovered URLs matching this regexp, or robots.txt-style glob:/path* pattern (repeatable), e.g. /cart or [?&]sort=", patternFlag(&c.Exclude))
+	fs.IntVar(&c.MaxDepth, "max-depth", 0, "don't follow links from pages this many hops from the seed; 1 crawls the seed and the pages it links to (0 = no limit)")
+	fs.BoolVar(&c.RespectNofollow, "respect-nofollow", false, "don't follow rel=\"nofollow\" links, or any link on pages whose robots meta tag or X-Robots-Tag header says nofollow")
+	fs.BoolVar(&c.FollowNoindex, "follow-noindex", true, "follow the links on pages marked noindex; set to false to leave them out of discovery")
+	fs.IntVar(&c.MaxHosts, "max-hosts", 0, "follow links to at most this many distinct hosts, the seed's included; links to further hosts are skipped (0 = no limit)")
+	fs.BoolVar(&c.Subtree, "subtree", false, "from each page, only follow links below that page's directory (on top of -scope)")
+	fs.Func("scope-allow-domains", "comma-separated domains whose links are followed even when out of -scope (subdomains included)", ListFlag(&c.ScopeAllowDomains))
+	fs.Func("scope-allow-rels", "comma-separated rel values (e.g. alternate) whose <a> and <link> targets are followed even when out of -scope", ListFlag(&c.ScopeAllowRels))
+	fs.IntVar(&c.EmptyStreak, "empty-streak", 0, "stop expanding a path after this many consecutive near-empty pages, or pages repeating one of its last N (0 disables)")
+	fs.IntVar(&c.EmptyWords, "empty-words", 50, "pages with fewer visible words than this count as empty for -empty-streak")
+	fs.IntVar(&c.TrapRepeat, "trap-repeat", 3, "treat URLs repeating a path segment or query param more than this many times as crawler traps (0 disables)")
+	fs.IntVar(&c.TrapMaxParams, "trap-max-params", 12, "treat URLs with more query params than this as crawler traps (0 disables)")
+}
+
+// DefaultRunID returns the run ID of a run started now without -tag.
+func DefaultRunID() string {
+	return "run-" + time.Now().Format("20060102-150405")
+}
+
+// ListFlag returns a flag.Func handler that appends the comma-separated
+// values of each use of the flag to dst.
+func ListFlag(dst *[]string) func(string) error {
+	return func(v string) error {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	}
+}
+
+// patternFlag returns a flag.Func handler that appends each use of an
+// -include, -exclude or -render-pattern flag to dst, rejecting patterns
+// that don't compile.
+func patternFlag(dst *[]string) func(string) error {
+	return func(v string) error {
+		if _, err := fetch.CompileURLPattern(v); err != nil {
+			return err
+		}
+		*dst = append(*dst, v)
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ============================================================================
+// CONFIG FILE
+// ============================================================================
+
+// A -config file sets flags by name, so everything that can be passed on
+// the command line can be kept in a file instead:
+//
+//	url: https://example.com/
+//	scope: host
+//	workers: 10
+//	host-delay: 500ms
+//	db: postgres://crawler@localhost/crawls
+//	scope-allow-rels: [alternate]
+//
+// Files ending in .toml are read as TOML, anything else as YAML (which
+// covers JSON too). Lists are applied item by item, as if the flag had
+// been repeated. Flags given on the command line override the file.
+
+// readConfigFile parses a -config file into flag names and values.
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// ApplyConfigFile sets the flags of fs named in the file at path, except
+// those in skip. Unknown names and invalid values are all reported in one
+// error.
+func ApplyConfigFile(fs *flag.FlagSet, path string, skip map[string]bool) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			problems = append(problems, fmt.Sprintf("unknown setting %q", name))
+			continue
+		}
+		if skip[name] {
+			continue
+		}
+
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		for _, item := range items {
+			switch item.(type) {
+			case map[string]any, []any:
+				problems = append(problems, fmt.Sprintf("%s: want a value or a list of values", name))
+				continue
+			}
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid value %q: %v", name, fmt.Sprint(item), err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// LoadConfig returns the default configuration with the settings of the
+// -config file at path applied, for crawls started from Go code.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+	RegisterFlags(fs, &c)
+	err := ApplyConfigFile(fs, path, nil)
+	return c, err
+}
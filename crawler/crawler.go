@@ -0,0 +1,272 @@
+// Package crawler discovers and scrapes the pages of a site into a
+// database: it runs the workers, discovery and seed sources of a crawl,
+// fetching through the fetch package, extracting with the parser package
+// and storing with the storage package.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CRAWLER
+// ============================================================================
+
+// Crawler runs crawls from Go code, the same way the command line does:
+//
+//	c := crawler.New(crawler.DefaultConfig(), store, nil,
+//		crawler.WithSeed("https://example.com/"),
+//		crawler.WithWorkers(10),
+//		crawler.WithScope(crawler.ScopeDomain),
+//	)
+//	err := c.Run(ctx)
+//
+// Options adjust the config, storage and parser passed to New. Each Crawler holds the state
+// of its own crawls, so several may run side by side; a single Crawler
+// runs one crawl at a time.
+type Crawler struct {
+	config       Config
+	store        storage.Storage
+	db           *gorm.DB // store.DB()
+	newParser    parser.ParserFactory
+	interceptors []fetch.RequestInterceptor
+	transport    func(base http.RoundTripper) http.RoundTripper
+
+	running atomic.Bool
+
+	// Set up for each crawl by setup.
+	client     *fetch.Client
+	normalizer parser.Normalizer
+	filters    *urlFilter   // -include, -exclude
+	revalidate *revalidator // -revalidate
+	budgets    *hostBudgets // -host-budget
+	tuner      *concurrencyTuner
+	writer     *pageWriter // -db-flush-interval, -db-batch
+	progress   *progressDisplay
+	crawlID    uint
+
+	// structuredDataRequired holds the fields each JSON-LD type needs
+	// with -validate-structured-data; nil otherwise.
+	structuredDataRequired map[string][]string
+
+	counts *counters
+}
+
+// counters are the page counts of the running crawl.
+type counters struct {
+	completed     atomic.Int64
+	success       atomic.Int64
+	failed        atomic.Int64
+	skipped       atomic.Int64 // recorded without extraction, see Page.SkipReason
+	thin          atomic.Int64
+	longRedirects atomic.Int64
+
+	// Pages found changed or unchanged against the previous run with
+	// -hash-gate, or unchanged through a 304 with -revalidate. Pages never
+	// crawled before count as neither.
+	changed   atomic.Int64
+	unchanged atomic.Int64
+
+	// seedErr is why the seed page failed, if it did.
+	seedErr atomic.Pointer[error]
+}
+
+// reset zeroes the counts for a new crawl. The counters are never
+// replaced, so Progress may read them while a crawl starts.
+func (c *counters) reset() {
+	for _, n := range []*atomic.Int64{&c.completed, &c.success, &c.failed, &c.skipped,
+		&c.thin, &c.longRedirects, &c.changed, &c.unchanged} {
+		n.Store(0)
+	}
+	c.seedErr.Store(nil)
+}
+
+// Option configures a Crawler.
+type Option func(*Crawler)
+
+// WithSeed sets the URL discovery starts from.
+func WithSeed(seedURL string) Option {
+	return func(c *Crawler) { c.config.SeedURL = seedURL }
+}
+
+// WithWorkers sets the number of scraping workers.
+func WithWorkers(n int) Option {
+	return func(c *Crawler) { c.config.Workers = n }
+}
+
+// WithParser replaces the parser factory passed to New. newParser is
+// called once per worker.
+func WithParser(newParser parser.ParserFactory) Option {
+	return func(c *Crawler) { c.newParser = newParser }
+}
+
+// WithStorage replaces the storage passed to New, for example with
+// storage.New of a database opened with storage.Open.
+func WithStorage(store storage.Storage) Option {
+	return func(c *Crawler) { c.store = store }
+}
+
+// WithScope sets which discovered links are followed: ScopeAny,
+// ScopeHost, ScopeSubdomains or ScopeDomain.
+func WithScope(mode string) Option {
+	return func(c *Crawler) { c.config.Scope = mode }
+}
+
+// WithInterceptors runs interceptors on every request of the crawl,
+// before the -hmac-key signature, see fetch.RequestInterceptor.
+func WithInterceptors(interceptors ...fetch.RequestInterceptor) Option {
+	return func(c *Crawler) { c.interceptors = append(c.interceptors, interceptors...) }
+}
+
+// WithTransport wraps or replaces the transport the crawl's requests
+// are sent through, see fetch.WithTransport.
+func WithTransport(wrap func(base http.RoundTripper) http.RoundTripper) Option {
+	return func(c *Crawler) { c.transport = wrap }
+}
+
+// New returns a crawler for cfg, adjusted by opts, that saves into store
+// and extracts pages with the parsers newParser builds, one per worker.
+// A nil store opens the config's DBPath when a crawl starts; a nil
+// newParser uses the built-in parser. WithStorage and WithParser
+// override both.
+func New(cfg Config, store storage.Storage, newParser parser.ParserFactory, opts ...Option) *Crawler {
+	c := &Crawler{config: cfg, store: store, newParser: newParser, counts: new(counters)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.config.RunID == "" {
+		c.config.RunID = DefaultRunID()
+	}
+	if c.newParser == nil {
+		c.newParser = parser.NewDefaultParserFactory(parser.DefaultParser{
+			ListResources: c.config.ListResources,
+			MetaWatchlist: c.config.MetaWatchlist,
+			RobotsUA:      c.config.RobotsUA,
+		})
+	}
+	return c
+}
+
+// Run crawls until discovery is done or ctx is canceled, like Crawl, but
+// only reports whether it succeeded.
+func (c *Crawler) Run(ctx context.Context) error {
+	_, err := c.Crawl(ctx)
+	return err
+}
+
+// Crawl runs one crawl into the crawler's run, see RunID, and returns its saved stats. Canceling ctx stops the crawl early; the
+// stats collected so far are still saved and returned with ctx's error.
+// When the seed can't be fetched and no page was crawled, the stats are
+// returned with the seed's error.
+func (c *Crawler) Crawl(ctx context.Context) (storage.CrawlStats, error) {
+	if err := c.config.Validate(); err != nil {
+		return storage.CrawlStats{}, err
+	}
+	if !c.running.CompareAndSwap(false, true) {
+		return storage.CrawlStats{}, errors.New("crawl already running")
+	}
+	defer c.running.Store(false)
+
+	if c.store == nil {
+		db, err := storage.Open(c.config.DBPath, c.pool())
+		if err != nil {
+			return storage.CrawlStats{}, err
+		}
+		c.store = storage.New(db)
+	}
+	c.db = c.store.DB()
+
+	c.counts.reset()
+	if err := c.setup(ctx, true); err != nil {
+		return storage.CrawlStats{}, err
+	}
+	defer c.client.Close()
+	return c.runCrawl(ctx)
+}
+
+// RunID returns the run the crawler stores into, set by New when the
+// config leaves it empty. Every Crawl of the crawler stores into it.
+func (c *Crawler) RunID() string {
+	return c.config.RunID
+}
+
+// Progress is a snapshot of the page counts of a crawl.
+type Progress struct {
+	Completed int64
+	Success   int64
+	Failed    int64
+	Skipped   int64
+}
+
+// Progress returns the page counts of the running crawl, or of the last
+// one once it has finished.
+func (c *Crawler) Progress() Progress {
+	counts := c.counts
+	return Progress{
+		Completed: counts.completed.Load(),
+		Success:   counts.success.Load(),
+		Failed:    counts.failed.Load(),
+		Skipped:   counts.skipped.Load(),
+	}
+}
+
+// pool returns the -db-max-open-conns, -db-max-idle-conns and
+// -db-conn-max-lifetime settings.
+func (c *Crawler) pool() storage.Pool {
+	return storage.Pool{
+		MaxOpenConns:    c.config.DBMaxOpenConns,
+		MaxIdleConns:    c.config.DBMaxIdleConns,
+		ConnMaxLifetime: c.config.DBConnMaxLifetime,
+	}
+}
+
+// setup creates the fetch client and the optional helpers of the config,
+// leaving the ones not enabled nil. Without stored runs, as for Inspect,
+// the helpers that read or keep state in the database (-revalidate,
+// -host-budget) stay off.
+func (c *Crawler) setup(ctx context.Context, stored bool) error {
+	c.normalizer = c.config.Normalizer()
+	c.filters, c.revalidate, c.budgets, c.structuredDataRequired = nil, nil, nil, nil
+	if len(c.config.Include) > 0 || len(c.config.Exclude) > 0 {
+		filters, err := newURLFilter(c.config.Include, c.config.Exclude)
+		if err != nil {
+			return fmt.Errorf("invalid URL filter: %w", err)
+		}
+		c.filters = filters
+	}
+	if c.config.ValidateStructuredData || c.config.StructuredDataRules != "" {
+		rules, err := parser.LoadStructuredDataRules(c.config.StructuredDataRules)
+		if err != nil {
+			return fmt.Errorf("failed to load structured data rules: %w", err)
+		}
+		c.structuredDataRequired = rules
+	}
+
+	opts := []fetch.Option{fetch.WithInterceptors(c.interceptors...)}
+	if c.transport != nil {
+		opts = append(opts, fetch.WithTransport(c.transport))
+	}
+	if c.config.Revalidate && stored {
+		c.revalidate = newRevalidator(c)
+		opts = append(opts, fetch.WithValidators(c.revalidate.Apply))
+	}
+	if c.config.HostBudget > 0 && stored {
+		c.budgets = newHostBudgets(c.db, c.config.HostBudget, c.config.HostBudgetWindow)
+		opts = append(opts, fetch.WithBudget(c.budgets))
+	}
+	client, err := fetch.New(ctx, c.config.Config, opts...)
+	if err != nil {
+		return err
+	}
+	c.client = client
+	return nil
+}
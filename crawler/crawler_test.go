@@ -0,0 +1,418 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crawl-guardian.com/crawler"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// newTestCrawler returns a crawler for seed that saves into an in-memory
+// database, along with the database.
+func newTestCrawler(t *testing.T, seed string) (*crawler.Crawler, *gorm.DB) {
+	t.Helper()
+	db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := crawler.DefaultConfig()
+	cfg.Quiet = true
+	cfg.Robots = false
+	return crawler.New(cfg, storage.New(db), nil, crawler.WithSeed(seed), crawler.WithWorkers(1)), db
+}
+
+func TestCrawlChunkedResponse(t *testing.T) {
+	body := "<html><head><title>Chunked</title></head><body>" + strings.Repeat("<p>chunked body</p>", 500) + "</body></html>"
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		for rest := body; rest != ""; {
+			n := min(256, len(rest))
+			io.WriteString(w, rest[:n])
+			w.(http.Flusher).Flush()
+			rest = rest[n:]
+		}
+	}))
+	defer site.Close()
+
+	c, db := newTestCrawler(t, site.URL+"/")
+	if _, err := c.Crawl(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var page storage.Page
+	if err := db.Scopes(storage.RunScope(c.RunID())).Where("url = ?", site.URL+"/").First(&page).Error; err != nil {
+		t.Fatal(err)
+	}
+	if page.ContentLength != -1 {
+		t.Errorf("stored ContentLength = %d, want -1 for a chunked response", page.ContentLength)
+	}
+	if page.BodyBytes != int64(len(body)) {
+		t.Errorf("stored BodyBytes = %d, want %d", page.BodyBytes, len(body))
+	}
+	if page.Truncated {
+		t.Error("page stored as truncated")
+	}
+}
+
+func TestCrawlSeedUnreachable(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	// robots.txt answering 503 leaves the whole host disallowed, so the
+	// seed is refused before it reaches a worker.
+	robotsDown := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><head><title>Up</title></head><body></body></html>")
+	}))
+	defer robotsDown.Close()
+
+	tests := []struct {
+		name   string
+		seed   string
+		robots bool
+	}{
+		{"connection refused", closed.URL + "/", false},
+		{"robots.txt 503", robotsDown.URL + "/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := crawler.DefaultConfig()
+			cfg.Quiet = true
+			cfg.Robots = tt.robots
+			cfg.MaxAttempts = 1
+			c := crawler.New(cfg, storage.New(db), nil, crawler.WithSeed(tt.seed), crawler.WithWorkers(1))
+
+			done := make(chan struct{})
+			var stats storage.CrawlStats
+			go func() {
+				defer close(done)
+				stats, err = c.Crawl(context.Background())
+			}()
+			select {
+			case <-done:
+			case <-time.After(30 * time.Second):
+				t.Fatal("crawl of an unreachable seed did not return")
+			}
+
+			if err == nil {
+				t.Fatalf("crawl of an unreachable seed succeeded: %+v", stats)
+			}
+			if !strings.Contains(err.Error(), tt.seed) {
+				t.Errorf("error %q does not mention the seed %s", err, tt.seed)
+			}
+			if stats.SuccessPages != 0 {
+				t.Errorf("SuccessPages = %d, want 0", stats.SuccessPages)
+			}
+		})
+	}
+}
+
+// recordingStorage counts the calls made to it, by method.
+type recordingStorage struct {
+	storage.Storage
+	calls *callCounts
+}
+
+type callCounts struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+func newRecordingStorage(db *gorm.DB) recordingStorage {
+	return recordingStorage{storage.New(db), &callCounts{n: map[string]int{}}}
+}
+
+func (s recordingStorage) record(method string) {
+	s.calls.mu.Lock()
+	s.calls.n[method]++
+	s.calls.mu.Unlock()
+}
+
+func (s recordingStorage) Calls(method string) int {
+	s.calls.mu.Lock()
+	defer s.calls.mu.Unlock()
+	return s.calls.n[method]
+}
+
+func (s recordingStorage) SavePage(page *storage.Page, details storage.PageDetails, mode string) error {
+	s.record("SavePage")
+	return s.Storage.SavePage(page, details, mode)
+}
+
+func (s recordingStorage) SaveEdges(edges []storage.Edge) error {
+	s.record("SaveEdges")
+	return s.Storage.SaveEdges(edges)
+}
+
+func (s recordingStorage) PreviousPage(runID, url string) (*storage.Page, error) {
+	s.record("PreviousPage")
+	return s.Storage.PreviousPage(runID, url)
+}
+
+func (s recordingStorage) Details(pageID uint) (storage.PageDetails, error) {
+	s.record("Details")
+	return s.Storage.Details(pageID)
+}
+
+func (s recordingStorage) Transaction(fn func(tx storage.Storage) error) error {
+	return s.Storage.Transaction(func(tx storage.Storage) error {
+		return fn(recordingStorage{tx, s.calls})
+	})
+}
+
+// upperTitleParser is the default parser with titles in upper case.
+type upperTitleParser struct {
+	parser.DefaultParser
+}
+
+func (p *upperTitleParser) GetSEOData(resp *http.Response) (parser.SEOData, error) {
+	data, err := p.DefaultParser.GetSEOData(resp)
+	data.Title = strings.ToUpper(data.Title)
+	return data, err
+}
+
+func TestWithStorageAndParser(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<html><head><title>Home</title></head><body>home</body></html>`)
+	}))
+	defer site.Close()
+
+	ignored, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newRecordingStorage(db)
+	var parsers atomic.Int64
+
+	cfg := crawler.DefaultConfig()
+	cfg.Quiet = true
+	cfg.Robots = false
+	cfg.MaxPages = 1
+	c := crawler.New(cfg, storage.New(ignored), nil,
+		crawler.WithSeed(site.URL+"/"),
+		crawler.WithWorkers(2),
+		crawler.WithStorage(store),
+		crawler.WithParser(func() parser.Parser {
+			parsers.Add(1)
+			return &upperTitleParser{}
+		}),
+	)
+	if _, err := c.Crawl(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.Calls("SavePage"); got != 1 {
+		t.Errorf("saved %d pages through WithStorage, want 1", got)
+	}
+	if got := parsers.Load(); got != 2 {
+		t.Errorf("WithParser factory called %d times, want once per worker (2)", got)
+	}
+	var page storage.Page
+	if err := db.Scopes(storage.RunScope(c.RunID())).First(&page).Error; err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "HOME" {
+		t.Errorf("stored title %q, want %q from the WithParser parser", page.Title, "HOME")
+	}
+	var count int64
+	if err := ignored.Model(&storage.Page{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d pages stored in the storage passed to New, want 0", count)
+	}
+}
+
+func TestProgressDuringCrawl(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<html><head><title>Page</title></head><body><a href="/a">a</a><a href="/b">b</a></body></html>`)
+	}))
+	defer site.Close()
+
+	c, _ := newTestCrawler(t, site.URL+"/")
+	runID := c.RunID()
+	if runID == "" {
+		t.Fatal("New left the run ID empty")
+	}
+
+	// Read the crawler the way /healthz does while it crawls twice.
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if c.RunID() != runID {
+					t.Errorf("RunID changed to %q during the crawl", c.RunID())
+				}
+				_ = c.Progress()
+			}
+		}
+	}()
+	for range 2 {
+		if _, err := c.Crawl(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Progress().Success; got != 3 {
+			t.Errorf("Progress().Success = %d after a crawl, want 3", got)
+		}
+	}
+	close(stop)
+	<-polled
+}
+
+// peakConcurrency crawls a site of slow pages with cfg and returns the
+// most page requests the site saw at once.
+func peakConcurrency(t *testing.T, cfg crawler.Config) int64 {
+	t.Helper()
+	var inFlight, peak atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head><title>Page</title></head><body>")
+		if r.URL.Path == "/" {
+			for i := range 24 {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		}
+		io.WriteString(w, "</body></html>")
+	}))
+	defer site.Close()
+
+	db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := crawler.New(cfg, storage.New(db), nil, crawler.WithSeed(site.URL+"/"))
+	if _, err := c.Crawl(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Progress().Success; got != 25 {
+		t.Fatalf("crawled %d pages, want 25", got)
+	}
+	return peak.Load()
+}
+
+func TestAutoTuneLimitsDiscoveryRequests(t *testing.T) {
+	cfg := crawler.DefaultConfig()
+	cfg.Quiet = true
+	cfg.Robots = false
+	cfg.HostConcurrency = 0
+	cfg.Workers = 8
+
+	if peak := peakConcurrency(t, cfg); peak < 4 {
+		t.Fatalf("without -autotune at most %d requests ran at once, want up to 8", peak)
+	}
+
+	// Every response is slower than -autotune-max-latency, so the limit
+	// never grows from -min-workers.
+	cfg.AutoTune = true
+	cfg.MinWorkers = 1
+	cfg.MaxWorkers = 8
+	cfg.AutoTuneInterval = 20 * time.Millisecond
+	cfg.AutoTuneMaxLatency = 5 * time.Millisecond
+	if peak := peakConcurrency(t, cfg); peak != 1 {
+		t.Errorf("with -autotune under high latency %d requests ran at once, want 1", peak)
+	}
+}
+
+func TestHashGateThroughStorage(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><h1>Page</h1><a href="/a">a</a><a href="/b">b</a></body></html>`, r.URL.Path)
+	}))
+	defer site.Close()
+
+	db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := crawler.DefaultConfig()
+	cfg.Quiet = true
+	cfg.Robots = false
+	cfg.HashGate = true
+
+	var runs []string
+	for i := range 2 {
+		store := newRecordingStorage(db)
+		cfg.RunID = fmt.Sprintf("run-%d", i)
+		c := crawler.New(cfg, store, nil, crawler.WithSeed(site.URL+"/"))
+		if _, err := c.Crawl(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, c.RunID())
+
+		if got := store.Calls("SaveEdges"); got != 3 {
+			t.Errorf("crawl %d saved the links of %d pages through the storage, want 3", i, got)
+		}
+		if got := store.Calls("PreviousPage"); got != 3 {
+			t.Errorf("crawl %d looked up %d previous pages through the storage, want 3", i, got)
+		}
+		wantDetails := 0
+		if i == 1 {
+			wantDetails = 3 // every page is unchanged and reused
+		}
+		if got := store.Calls("Details"); got != wantDetails {
+			t.Errorf("crawl %d loaded the details of %d pages through the storage, want %d", i, got, wantDetails)
+		}
+	}
+
+	var reused int64
+	if err := db.Model(&storage.Page{}).Scopes(storage.RunScope(runs[1])).Where("reused").Count(&reused).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reused != 3 {
+		t.Errorf("second crawl reused %d pages, want 3", reused)
+	}
+	var headings int64
+	err = db.Model(&storage.Heading{}).
+		Joins("JOIN pages ON pages.id = headings.page_id").
+		Where("pages.run_id = ?", runs[1]).
+		Count(&headings).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headings != 3 {
+		t.Errorf("reused pages have %d headings, want 3", headings)
+	}
+}
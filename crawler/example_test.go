@@ -0,0 +1,59 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"crawl-guardian.com/crawler"
+	"crawl-guardian.com/storage"
+)
+
+// Example_crawl embeds a crawl in a Go program: a small site is crawled
+// into an in-memory database and the stored pages are read back.
+func Example_crawl() {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><title>Home</title></head><body><a href="/about">About</a></body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<html><head><title>About us</title></head><body><a href="/">Home</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	db, err := storage.Open(storage.MemoryDB, storage.Pool{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := crawler.DefaultConfig()
+	cfg.Quiet = true
+	c := crawler.New(cfg, storage.New(db), nil,
+		crawler.WithSeed(site.URL+"/"),
+		crawler.WithWorkers(2),
+	)
+	stats, err := c.Crawl(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d pages, %d ok\n", stats.TotalPages, stats.SuccessPages)
+
+	var pages []storage.Page
+	if err := db.Scopes(storage.RunScope(c.RunID())).Order("url").Find(&pages).Error; err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range pages {
+		fmt.Printf("%s %d %q\n", strings.TrimPrefix(p.URL, site.URL), p.StatusCode, p.Title)
+	}
+	// Output:
+	// 2 pages, 2 ok
+	// / 200 "Home"
+	// /about 200 "About us"
+}
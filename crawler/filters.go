@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"net/url"
+
+	"crawl-guardian.com/fetch"
+)
+
+// ============================================================================
+// URL FILTERS
+// ============================================================================
+
+// urlFilter keeps discovery away from URLs matching an -exclude pattern
+// and, when there are -include patterns, from URLs matching none of them.
+// The -url seed is always crawled; CSV and sitemap seeds are filtered.
+type urlFilter struct {
+	include []fetch.URLPattern
+	exclude []fetch.URLPattern
+}
+
+func newURLFilter(include, exclude []string) (*urlFilter, error) {
+	f := &urlFilter{}
+	for _, pattern := range include {
+		p, err := fetch.CompileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, p)
+	}
+	for _, pattern := range exclude {
+		p, err := fetch.CompileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, p)
+	}
+	return f, nil
+}
+
+// Allowed reports whether discovery may follow rawURL.
+func (f *urlFilter) Allowed(rawURL string) bool {
+	if f == nil {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, p := range f.exclude {
+		if p.Match(u) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.Match(u) {
+			return true
+		}
+	}
+	return false
+}
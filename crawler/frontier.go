@@ -0,0 +1,348 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// FRONTIERS
+// ============================================================================
+
+// urlFrontier is the queue of URLs discovery has yet to fetch, which also
+// remembers every URL queued before so none is fetched twice.
+type urlFrontier interface {
+	// Push queues task unless its URL has been seen before in this run.
+	Push(task crawlTask) (bool, error)
+	// Pop takes the next pending URL off the queue.
+	Pop() (crawlTask, bool, error)
+}
+
+// memoryFrontier is the frontier of a plain crawl. It holds at most
+// -max-pages URLs, as discovery stops queueing once that many are known.
+type memoryFrontier struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	queue []crawlTask
+	busy  func(rawURL string) bool
+}
+
+// frontierLookahead is how far down the queue memoryFrontier.Pop looks
+// for a URL whose host has a free -host-concurrency slot.
+const frontierLookahead = 100
+
+// newMemoryFrontier returns an empty frontier. busy reports whether a
+// URL's host has every -host-concurrency slot taken.
+func newMemoryFrontier(busy func(rawURL string) bool) *memoryFrontier {
+	return &memoryFrontier{seen: make(map[string]bool), busy: busy}
+}
+
+func (f *memoryFrontier) Push(task crawlTask) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seen[task.URL] {
+		return false, nil
+	}
+	f.seen[task.URL] = true
+	f.queue = append(f.queue, task)
+	return true, nil
+}
+
+// Pop takes the oldest pending URL off the queue, passing over URLs of
+// hosts that already have -host-concurrency requests in flight while a
+// URL of another host is waiting, so discoverers don't all stall on one
+// busy host.
+func (f *memoryFrontier) Pop() (crawlTask, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) == 0 {
+		return crawlTask{}, false, nil
+	}
+
+	i := 0
+	for j := 0; j < min(len(f.queue), frontierLookahead); j++ {
+		if !f.busy(f.queue[j].URL) {
+			i = j
+			break
+		}
+	}
+	task := f.queue[i]
+	if i == 0 {
+		f.queue[0] = crawlTask{}
+		f.queue = f.queue[1:]
+	} else {
+		f.queue = append(f.queue[:i], f.queue[i+1:]...)
+	}
+	return task, true, nil
+}
+
+// ----------------------------------------------------------------------------
+// Disk-backed frontier
+// ----------------------------------------------------------------------------
+
+const (
+	frontierPending = "pending"
+	frontierFetched = "fetched"
+)
+
+type diskFrontier struct {
+	mu    sync.Mutex
+	db    *gorm.DB
+	runID string
+}
+
+func newDiskFrontier(db *gorm.DB, runID string) *diskFrontier {
+	return &diskFrontier{db: db, runID: runID}
+}
+
+// Push queues task unless its URL has been seen before in this run.
+func (f *diskFrontier) Push(task crawlTask) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := storage.FrontierItem{
+		RunID:          f.runID,
+		URL:            task.URL,
+		State:          frontierPending,
+		ScopeException: task.ScopeException,
+		Depth:          task.Depth,
+		LastMod:        task.LastMod,
+		Priority:       task.Priority,
+	}
+	result := f.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&item)
+	if result.Error != nil {
+		return false, fmt.Errorf("frontier push failed: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Pop takes the oldest pending URL off the queue.
+func (f *diskFrontier) Pop() (crawlTask, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var item storage.FrontierItem
+	err := f.db.Where("run_id = ? AND state = ?", f.runID, frontierPending).
+		Order("id").First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return crawlTask{}, false, nil
+	}
+	if err != nil {
+		return crawlTask{}, false, fmt.Errorf("frontier pop failed: %w", err)
+	}
+
+	err = f.db.Model(&item).Update("state", frontierFetched).Error
+	if err != nil {
+		return crawlTask{}, false, fmt.Errorf("frontier pop failed: %w", err)
+	}
+	task := crawlTask{
+		URL:            item.URL,
+		ScopeException: item.ScopeException,
+		Depth:          item.Depth,
+		LastMod:        item.LastMod,
+		Priority:       item.Priority,
+	}
+	return task, true, nil
+}
+
+// Resume prepares the frontier of an interrupted run to be crawled again:
+// URLs taken off the queue whose page never got saved are queued again.
+// It returns the number of URLs known to the run and the number pending.
+func (f *diskFrontier) Resume() (known, pending int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.db.Model(&storage.FrontierItem{}).
+		Where("run_id = ? AND state = ?", f.runID, frontierFetched).
+		Where("url NOT IN (?)", f.db.Model(&storage.Page{}).Select("url").Where("run_id = ?", f.runID)).
+		Update("state", frontierPending).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("frontier resume failed: %w", err)
+	}
+	if err := f.db.Model(&storage.FrontierItem{}).Where("run_id = ?", f.runID).Count(&known).Error; err != nil {
+		return 0, 0, fmt.Errorf("frontier resume failed: %w", err)
+	}
+	err = f.db.Model(&storage.FrontierItem{}).Where("run_id = ? AND state = ?", f.runID, frontierPending).Count(&pending).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("frontier resume failed: %w", err)
+	}
+	return known, pending, nil
+}
+
+// ============================================================================
+// DISCOVERY
+// ============================================================================
+
+// discoverURLs crawls outwards from seedURL through a frontier: a fixed
+// pool of -discovery-workers discoverers takes URLs off it, fetches them,
+// hands the pages to the workers and queues their links. Discoverers
+// block on the worklist when the workers fall behind, so goroutines don't
+// pile up however many links pages have. URLs already in the frontier,
+// as when resuming, count towards maxURLs.
+func (c *Crawler) discoverURLs(ctx context.Context, seedURL string, worklist chan<- crawlTask, maxURLs int, known int, done chan<- bool, frontier urlFrontier) {
+	if normalized, err := c.normalizer.Normalize(seedURL); err == nil {
+		seedURL = normalized
+	}
+
+	var streaks *emptyStreakTracker
+	if c.config.EmptyStreak > 0 {
+		streaks = newEmptyStreakTracker(c.config.EmptyStreak, c.config.EmptyWords)
+	}
+	traps := newTrapDetector(c.config.TrapRepeat, c.config.TrapMaxParams)
+	scope := c.newCrawlScope(seedURL)
+
+	var mu sync.Mutex
+	idle := sync.NewCond(&mu)
+	inFlight := 0
+	count := known
+
+	// enqueue must be called with mu held.
+	enqueue := func(task crawlTask) {
+		if count >= maxURLs || traps.IsTrap(task.URL) {
+			return
+		}
+		if streaks != nil && streaks.Abandoned(task.URL) {
+			return
+		}
+		added, err := frontier.Push(task)
+		if err != nil {
+			slog.Error("failed to queue url", "url", task.URL, "error", err)
+			return
+		}
+		if added {
+			count++
+		}
+	}
+
+	// next blocks until a URL is available, or returns false once the
+	// frontier is empty and no discoverer can add to it any more, or the
+	// crawl has been cancelled.
+	next := func() (crawlTask, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			if ctx.Err() != nil {
+				idle.Broadcast()
+				return crawlTask{}, false
+			}
+			task, ok, err := frontier.Pop()
+			if err != nil {
+				slog.Error("failed to read frontier", "error", err)
+				return crawlTask{}, false
+			}
+			if ok {
+				inFlight++
+				return task, true
+			}
+			if inFlight == 0 {
+				idle.Broadcast()
+				return crawlTask{}, false
+			}
+			idle.Wait()
+		}
+	}
+
+	// Sitemap URLs go in right after the seed, so they are queued with
+	// their lastmod and priority before any link can reach them.
+	var sitemapTasks []crawlTask
+	if c.config.WithSitemap {
+		sitemapTasks = c.loadDiscoverySitemap(ctx, seedURL)
+	}
+
+	// Disallowed URLs don't count towards -max-pages. robots.txt is
+	// checked before taking mu, as it may fetch.
+	allowed := func(task crawlTask) bool {
+		ok, err := c.client.Allowed(ctx, task.URL)
+		return err == nil && ok
+	}
+
+	// A refused seed fails the crawl like one that couldn't be fetched,
+	// as nothing else will be queued.
+	var start []crawlTask
+	for _, task := range append([]crawlTask{{URL: seedURL}}, sitemapTasks...) {
+		switch {
+		case allowed(task):
+			start = append(start, task)
+		case task.URL == seedURL:
+			seedErr := fmt.Errorf("failed to crawl seed %s: %w", seedURL, fetch.ErrDisallowed)
+			c.counts.seedErr.Store(&seedErr)
+		}
+	}
+	mu.Lock()
+	for _, task := range start {
+		enqueue(task)
+	}
+	mu.Unlock()
+
+	// Discoverers make the page requests, so by default there are as many
+	// as workers and -workers sets the crawl's parallelism.
+	discoverers := c.config.DiscoveryWorkers
+	if discoverers <= 0 {
+		discoverers = c.config.Workers
+		if c.config.AutoTune {
+			discoverers = max(c.config.MaxWorkers, c.config.MinWorkers)
+		}
+	}
+	// Wake discoverers waiting for work once the crawl is cancelled, so
+	// they stop instead of waiting for the others to drain the frontier.
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		idle.Broadcast()
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(discoverers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := next()
+				if !ok {
+					return
+				}
+				task.Seed = task.URL == seedURL
+
+				links, followable := c.expandPage(ctx, task, worklist, streaks)
+				if err := c.saveEdges(task.URL, links); err != nil {
+					slog.Error("failed to save links", "url", task.URL, "error", err)
+				}
+				if !followable || !c.followsLinks(task) {
+					links = nil
+				}
+
+				var follow []crawlTask
+				for _, link := range links {
+					next, ok := scope.Follow(task.URL, link)
+					if !ok || !allowed(next) {
+						continue
+					}
+					next.Depth = task.Depth + 1
+					follow = append(follow, next)
+				}
+
+				mu.Lock()
+				for _, next := range follow {
+					enqueue(next)
+				}
+				inFlight--
+				idle.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		stop()
+		done <- true
+	}()
+}
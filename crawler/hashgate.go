@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"time"
+
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// HASH-GATED RECRAWLS
+// ============================================================================
+
+// previousPage returns the latest page stored for url by an earlier run,
+// or nil if there is none with a content hash.
+func (c *Crawler) previousPage(url string) (*storage.Page, error) {
+	return c.store.PreviousPage(c.config.RunID, url)
+}
+
+// reuseUnchanged stores prev for task with reusePage and counts it as an
+// unchanged, successful page.
+func (c *Crawler) reuseUnchanged(prev *storage.Page, task crawlTask) error {
+	if err := c.reusePage(prev, task); err != nil {
+		return err
+	}
+	c.counts.unchanged.Add(1)
+	if prev.ThinContent {
+		c.counts.thin.Add(1)
+	}
+	if prev.LongRedirectChain {
+		c.counts.longRedirects.Add(1)
+	}
+	c.counts.success.Add(1)
+	c.counts.completed.Add(1)
+	return nil
+}
+
+// reusePage copies an unchanged page, with its resources, headings and
+// anchor links, into the current run instead of extracting it again. Only
+// the crawl time and what the crawl itself knows about the URL are
+// updated, so extraction settings changed since that run, such as
+// -validate-structured-data, only apply to changed pages.
+func (c *Crawler) reusePage(prev *storage.Page, task crawlTask) error {
+	details, err := c.store.Details(prev.ID)
+	if err != nil {
+		return err
+	}
+
+	page := *prev
+	page.ID = 0
+	page.RunID = c.config.RunID
+	page.CrawlID = c.crawlID
+	page.Seed = task.Seed
+	page.ScopeException = task.ScopeException
+	page.Depth = task.Depth
+	page.LastMod = task.LastMod
+	page.SitemapPriority = task.Priority
+	page.CrawledAt = time.Now()
+	page.CreatedAt = time.Time{}
+	page.Reused = true
+	return c.store.SavePage(&page, details, c.config.OnRecrawl)
+}
@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+)
+
+// ============================================================================
+// INSPECT MODE
+// ============================================================================
+
+// Inspect fetches and parses a single page outside a crawl. No database,
+// workers or discovery are involved, but the request helpers (signing,
+// cookies, login, robots.txt) are set up as for a crawl, on the first
+// call; Close releases them. Only HTML is parsed; other responses get
+// their status, content type and size only, like the pages a crawl skips
+// as not-html.
+func (c *Crawler) Inspect(ctx context.Context, url string) (parser.SEOData, error) {
+	if c.client == nil {
+		if err := c.config.Validate(); err != nil {
+			return parser.SEOData{}, err
+		}
+		if err := c.setup(ctx, false); err != nil {
+			return parser.SEOData{}, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := c.client.Get(ctx, url)
+	if err != nil {
+		return parser.SEOData{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return parser.SEOData{}, fmt.Errorf("read failed: %w", err)
+	}
+	fetch.FinishTimings(resp.Request)
+	truncated := fetch.Truncated(resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	contentType := fetch.ContentType(resp, body)
+	if !fetch.IsHTML(contentType) {
+		data := parser.SEOData{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+		if source, hops := parser.RedirectSource(resp); hops > 0 {
+			data.FinalURL, data.URL = data.URL, source
+			data.RedirectHops = hops
+			data.RedirectChain, data.RedirectLoop = parser.RedirectChain(resp)
+		}
+		c.addRequestFacts(&data, resp)
+		data.ContentType = contentType
+		data.ContentLength = resp.ContentLength
+		data.BodyBytes = int64(len(body))
+		data.Truncated = truncated
+		return data, nil
+	}
+
+	data, err := c.newParser().GetSEOData(resp)
+	if err != nil {
+		return data, fmt.Errorf("parse failed: %w", err)
+	}
+	c.addRequestFacts(&data, resp)
+	data.ContentHash = parser.ContentHash(body)
+	data.ContentType = contentType
+	data.ContentLength = resp.ContentLength
+	data.BodyBytes = int64(len(body))
+	data.Truncated = truncated
+	return data, nil
+}
+
+// Close releases the request helpers set up by Inspect.
+func (c *Crawler) Close() {
+	if c.client != nil && !c.running.Load() {
+		c.client.Close()
+		c.client = nil
+	}
+}
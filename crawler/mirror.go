@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"crawl-guardian.com/parser"
+)
+
+// ============================================================================
+// FILESYSTEM MIRROR
+// ============================================================================
+
+// Longest file or directory name written for a single URL segment.
+const maxSegmentLength = 100
+
+// dirIndexName is the file name of directory URLs. sanitizeSegment never
+// returns it, since it only writes "~" before a hash, so /a/ and /a/index
+// get files of their own.
+const dirIndexName = "_index~dir"
+
+// mirrorPath maps a page URL to a file path (without extension) below
+// root: <root>/<host>/<path segments>. Directory URLs map to
+// dirIndexName, query strings become a "~q-" hash suffix, and any segment
+// that had to be sanitized gets a "~" hash of its original value so
+// distinct URLs never share a file. The result is guaranteed to stay
+// inside root.
+func mirrorPath(root, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{sanitizeSegment(u.Host)}
+
+	segments := strings.Split(u.EscapedPath(), "/")
+	for _, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		parts = append(parts, sanitizeSegment(segment))
+	}
+
+	if len(parts) == 1 || strings.HasSuffix(u.Path, "/") || u.Path == "" {
+		parts = append(parts, dirIndexName)
+	}
+	if u.RawQuery != "" {
+		parts[len(parts)-1] += "~q-" + shortHash(u.RawQuery)
+	}
+
+	path := filepath.Join(append([]string{root}, parts...)...)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to write %s outside %s", rawURL, root)
+	}
+	return path, nil
+}
+
+func sanitizeSegment(segment string) string {
+	var sb strings.Builder
+	for _, r := range segment {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	clean := strings.TrimLeft(sb.String(), ".")
+	if len(clean) > maxSegmentLength {
+		clean = clean[:maxSegmentLength]
+	}
+	if clean != segment {
+		clean += "~" + shortHash(segment)
+	}
+	return clean
+}
+
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// writeMirrorFiles stores a page's SEO data as JSON and, when body is not
+// nil, its raw HTML next to it.
+func writeMirrorFiles(root string, data parser.SEOData, body []byte) error {
+	path, err := mirrorPath(root, data.URL)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".json", append(encoded, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write mirror file: %w", err)
+	}
+
+	if body != nil {
+		if err := os.WriteFile(path+".html", body, 0o644); err != nil {
+			return fmt.Errorf("failed to write mirror file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorPath(t *testing.T) {
+	root := filepath.FromSlash("/mirror")
+	long := strings.Repeat("a", 150)
+	tests := []struct {
+		url  string
+		want string // below root, slash-separated
+	}{
+		{"https://example.com", "example.com/_index~dir"},
+		{"https://example.com/", "example.com/_index~dir"},
+		{"https://example.com/a/", "example.com/a/_index~dir"},
+		{"https://example.com/a/index", "example.com/a/index"},
+		{"https://example.com/a/b", "example.com/a/b"},
+
+		// Traversal stays inside root.
+		{"https://example.com/../../etc/passwd", "example.com/etc/passwd"},
+		{"https://example.com/a/%2e%2e/%2E%2E/b", "example.com/a/b"},
+		{"https://example.com/..%2f..%2fetc", "example.com/_.._etc~" + shortHash("../../etc")},
+		{"https://example.com/.hidden", "example.com/hidden~" + shortHash(".hidden")},
+
+		// Query strings become a suffix of the last segment.
+		{"https://example.com/a?x=1", "example.com/a~q-" + shortHash("x=1")},
+		{"https://example.com/a?x=2", "example.com/a~q-" + shortHash("x=2")},
+		{"https://example.com/a/?x=1", "example.com/a/_index~dir~q-" + shortHash("x=1")},
+
+		// Sanitized and over-long segments keep a hash of the original.
+		{"https://example.com/a%20b", "example.com/a_b~" + shortHash("a b")},
+		{"https://example.com/a_b", "example.com/a_b"},
+		{"https://example.com/" + long, "example.com/" + long[:maxSegmentLength] + "~" + shortHash(long)},
+		{"https://example.com:8080/", "example.com_8080~" + shortHash("example.com:8080") + "/_index~dir"},
+	}
+	for _, tt := range tests {
+		got, err := mirrorPath(root, tt.url)
+		if err != nil {
+			t.Errorf("mirrorPath(%q): %v", tt.url, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("mirrorPath(%q) = %q, want %q", tt.url, got, want)
+		}
+	}
+}
+
+func TestMirrorPathDistinct(t *testing.T) {
+	urls := []string{
+		"https://example.com/a/",
+		"https://example.com/a/index",
+		"https://example.com/a/_index~dir",
+		"https://example.com/a/_index_dir",
+		"https://example.com/a",
+		"https://example.com/a?q",
+		"https://example.com/a~q-" + shortHash("q"),
+		"https://example.com/a_b",
+		"https://example.com/a b",
+		"https://example.com/a%3Fb",
+	}
+	seen := map[string]string{}
+	for _, u := range urls {
+		path, err := mirrorPath("/mirror", u)
+		if err != nil {
+			t.Fatalf("mirrorPath(%q): %v", u, err)
+		}
+		if prev, ok := seen[path]; ok {
+			t.Errorf("%s and %s share the file %s", prev, u, path)
+		}
+		seen[path] = u
+	}
+}
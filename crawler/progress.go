@@ -0,0 +1,161 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// LIVE PROGRESS
+// ============================================================================
+
+// progressDisplay redraws a block of status lines at the bottom of the
+// terminal while a crawl runs: page counts, queue size, rate, ETA against
+// -max-pages and the URL each worker is on. Log lines written through it
+// are printed above the block, so both stay readable.
+type progressDisplay struct {
+	out      io.Writer
+	counts   *counters
+	maxPages int
+	queue    func() int // URLs waiting in the worklist
+	start    time.Time
+
+	mu      sync.Mutex
+	current []string // URL per worker, "" when idle
+	drawn   int      // lines of the block currently on screen
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// progressInterval is how often the block is redrawn.
+const progressInterval = 500 * time.Millisecond
+
+// progressURLWidth cuts long worker URLs so each fits on one line.
+const progressURLWidth = 100
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts redrawing the block for workers workers on out.
+func startProgress(out io.Writer, counts *counters, workers, maxPages int, queue func() int) *progressDisplay {
+	p := &progressDisplay{
+		out:      out,
+		counts:   counts,
+		maxPages: maxPages,
+		queue:    queue,
+		start:    time.Now(),
+		current:  make([]string, workers),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Begin records that worker started on url.
+func (p *progressDisplay) Begin(worker int, url string) {
+	p.mu.Lock()
+	p.current[worker] = url
+	p.mu.Unlock()
+}
+
+// End records that worker is idle again.
+func (p *progressDisplay) End(worker int) {
+	p.mu.Lock()
+	p.current[worker] = ""
+	p.mu.Unlock()
+}
+
+// Write prints log output above the block.
+func (p *progressDisplay) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	n, err := p.out.Write(b)
+	p.draw()
+	return n, err
+}
+
+// Stop removes the block from the screen and stops redrawing it.
+func (p *progressDisplay) Stop() {
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	p.clear()
+	p.mu.Unlock()
+}
+
+// stopProgress takes the live progress display down, if shown, and
+// sends log output straight to stderr again.
+func (c *Crawler) stopProgress() {
+	if c.progress == nil {
+		return
+	}
+	c.progress.Stop()
+	c.progress = nil
+	log.SetOutput(os.Stderr)
+}
+
+func (p *progressDisplay) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.clear()
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// clear erases the block drawn last. p.mu must be held.
+func (p *progressDisplay) clear() {
+	for ; p.drawn > 0; p.drawn-- {
+		fmt.Fprint(p.out, "\x1b[1A\x1b[2K")
+	}
+}
+
+// draw writes the block. p.mu must be held.
+func (p *progressDisplay) draw() {
+	completed := p.counts.completed.Load()
+	elapsed := time.Since(p.start)
+	rate := float64(completed) / elapsed.Seconds()
+
+	eta := "-"
+	if remaining := int64(p.maxPages) - completed; rate > 0 && remaining > 0 {
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "pages %d/%d  ok %d  failed %d  skipped %d  queue %d  %.1f pages/s  eta %s  elapsed %s\n",
+		completed, p.maxPages, p.counts.success.Load(), p.counts.failed.Load(), p.counts.skipped.Load(),
+		p.queue(), rate, eta, elapsed.Round(time.Second))
+	for i, url := range p.current {
+		if url == "" {
+			url = "(idle)"
+		} else if len(url) > progressURLWidth {
+			url = url[:progressURLWidth-3] + "..."
+		}
+		fmt.Fprintf(&b, "  #%-2d %s\n", i+1, url)
+	}
+
+	fmt.Fprint(p.out, b.String())
+	p.drawn = 1 + len(p.current)
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"net/http"
+
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// CONDITIONAL RECRAWLS
+// ============================================================================
+
+// revalidator makes recrawls conditional: each request carries the ETag
+// and Last-Modified its URL was stored with by the latest earlier run in
+// the database, and a 304 Not Modified answer reuses that page, like
+// -hash-gate does for an unchanged body, without downloading it again.
+type revalidator struct {
+	crawler *Crawler
+}
+
+func newRevalidator(c *Crawler) *revalidator {
+	return &revalidator{crawler: c}
+}
+
+// Apply adds If-None-Match and If-Modified-Since to req when its URL was
+// fetched successfully before.
+func (r *revalidator) Apply(req *http.Request) {
+	prev, err := r.crawler.previousPage(r.crawler.normalizer.OrRaw(req.URL.String()))
+	if err != nil || prev == nil || prev.StatusCode != http.StatusOK {
+		return
+	}
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+}
+
+// Previous returns the page a 304 for pageURL confirms, or nil.
+func (r *revalidator) Previous(pageURL string) (*storage.Page, error) {
+	prev, err := r.crawler.previousPage(r.crawler.normalizer.OrRaw(pageURL))
+	if err != nil || prev == nil || prev.StatusCode != http.StatusOK {
+		return nil, err
+	}
+	return prev, nil
+}
+
+// Links returns the links stored for prev by its run, so discovery can
+// go on past a page that answered 304, and whether its robots directives
+// let discovery follow them.
+func (r *revalidator) Links(prev *storage.Page) ([]parser.Link, bool, error) {
+	edges, err := r.crawler.store.EdgesFrom(prev.RunID, prev.URL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	links := make([]parser.Link, len(edges))
+	for i, e := range edges {
+		links[i] = parser.Link{URL: e.ToURL, Rel: e.Rel, Text: e.Text}
+	}
+	return links, r.crawler.followsRobotsDirectives(parser.SEOData{Noindex: prev.Noindex, Nofollow: prev.Nofollow}), nil
+}
@@ -0,0 +1,331 @@
+package crawler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// SAVING PAGES
+// ============================================================================
+
+// savePage stores a scraped page of the run, with its resources,
+// headings and anchor links, into store (the crawler's storage or a
+// transaction of it).
+func (c *Crawler) savePage(store storage.Storage, data parser.SEOData) error {
+	data.URL = c.normalizer.OrRaw(data.URL)
+	if data.FinalURL != "" {
+		data.FinalURL = c.normalizer.OrRaw(data.FinalURL)
+	}
+	missingData := parser.MissingStructuredData(data.StructuredData, c.structuredDataRequired)
+	page := storage.Page{
+		RunID:                 c.config.RunID,
+		CrawlID:               c.crawlID,
+		URL:                   data.URL,
+		Title:                 data.Title,
+		H1:                    data.H1,
+		MetaDescription:       data.MetaDescription,
+		Meta:                  encodeMeta(data.Meta),
+		Lang:                  data.Lang,
+		DetectedLang:          data.DetectedLang,
+		LangMismatch:          parser.LangMismatch(data),
+		StatusCode:            data.StatusCode,
+		Noindex:               data.Noindex,
+		Nofollow:              data.Nofollow,
+		RobotsDirectives:      strings.Join(data.RobotsDirectives, ","),
+		FinalURL:              data.FinalURL,
+		RedirectHops:          data.RedirectHops,
+		RedirectChain:         parser.EncodeRedirectChain(data.RedirectChain),
+		RedirectLoop:          data.RedirectLoop,
+		LongRedirectChain:     c.isLongRedirect(data.RedirectHops),
+		Canonical:             data.Canonical,
+		OGURL:                 data.OGURL,
+		OGTitle:               data.OGTitle,
+		OGDescription:         data.OGDescription,
+		OGImage:               data.OGImage,
+		TwitterCard:           data.TwitterCard,
+		TwitterTitle:          data.TwitterTitle,
+		TwitterDescription:    data.TwitterDescription,
+		TwitterImage:          data.TwitterImage,
+		CanonicalMismatch:     c.canonicalMismatch(data),
+		InlineScripts:         data.InlineScripts,
+		ExternalScripts:       data.ExternalScripts,
+		InlineStyles:          data.InlineStyles,
+		Stylesheets:           data.Stylesheets,
+		WordCount:             data.WordCount,
+		Headings:              data.Headings,
+		HeadingDensity:        c.headingDensity(data),
+		H1Count:               data.H1Count,
+		H1Issue:               parser.H1Issue(data),
+		DNSMillis:             data.DNSMillis,
+		ConnectMillis:         data.ConnectMillis,
+		TLSMillis:             data.TLSMillis,
+		TTFBMillis:            data.TTFBMillis,
+		TotalMillis:           data.TotalMillis,
+		Attempts:              data.Attempts,
+		ThemeColor:            data.ThemeColor,
+		Manifest:              data.Manifest,
+		ServiceWorker:         data.ServiceWorker,
+		ContentHash:           data.ContentHash,
+		TextHash:              data.TextHash,
+		ContentType:           data.ContentType,
+		ETag:                  data.ETag,
+		LastModified:          data.LastModified,
+		Truncated:             data.Truncated,
+		Rendered:              data.Rendered,
+		ContentLength:         data.ContentLength,
+		BodyBytes:             data.BodyBytes,
+		LocalIP:               data.LocalIP,
+		Proxy:                 data.Proxy,
+		SetCookies:            strings.Join(data.SetCookies, ","),
+		ScriptCookies:         data.ScriptCookies,
+		AnchorLinks:           len(data.Anchors),
+		BrokenAnchors:         data.BrokenAnchors,
+		ThinContent:           c.isThinContent(data),
+		JSONLDTypes:           strings.Join(data.JSONLDTypes, ","),
+		PageType:              c.classifyPage(data),
+		StructuredDataValid:   len(missingData) == 0,
+		StructuredDataMissing: strings.Join(missingData, ","),
+		LastMod:               data.LastMod,
+		SitemapPriority:       data.SitemapPriority,
+		Seed:                  data.Seed,
+		ScopeException:        data.ScopeException,
+		Depth:                 data.Depth,
+		CrawledAt:             time.Now(),
+	}
+
+	return store.SavePage(&page, c.pageDetails(data), c.config.OnRecrawl)
+}
+
+// saveSkippedPage records a page whose body was not read or not parsed,
+// with what the response headers and contentType tell about it, and the
+// size of the body when it was read.
+func (c *Crawler) saveSkippedPage(task crawlTask, resp *http.Response, reason, contentType string, bodyBytes int64) error {
+	page := storage.Page{
+		RunID:           c.config.RunID,
+		CrawlID:         c.crawlID,
+		URL:             task.URL,
+		StatusCode:      resp.StatusCode,
+		Seed:            task.Seed,
+		ScopeException:  task.ScopeException,
+		Depth:           task.Depth,
+		LastMod:         task.LastMod,
+		SitemapPriority: task.Priority,
+		SkipReason:      reason,
+		ContentType:     contentType,
+		ContentLength:   resp.ContentLength,
+		BodyBytes:       bodyBytes,
+		Attempts:        fetch.Attempts(resp.Request),
+		CrawledAt:       time.Now(),
+	}
+	if t, ok := c.client.Timings(resp.Request); ok {
+		page.TTFBMillis, page.TotalMillis = t.TTFB, t.Total
+	}
+	if source, hops := parser.RedirectSource(resp); hops > 0 {
+		page.URL = c.normalizer.OrRaw(source)
+		page.FinalURL = c.normalizer.OrRaw(resp.Request.URL.String())
+		page.RedirectHops = hops
+		chain, loop := parser.RedirectChain(resp)
+		page.RedirectChain = parser.EncodeRedirectChain(chain)
+		page.RedirectLoop = loop
+		page.LongRedirectChain = c.isLongRedirect(hops)
+	}
+	return c.store.SavePage(&page, storage.PageDetails{}, c.config.OnRecrawl)
+}
+
+// saveFailedPage records a page that couldn't be fetched, so links to it
+// can be reported as broken.
+func (c *Crawler) saveFailedPage(task crawlTask, fetchErr error) error {
+	page := storage.Page{
+		RunID:           c.config.RunID,
+		CrawlID:         c.crawlID,
+		URL:             c.normalizer.OrRaw(task.URL),
+		Seed:            task.Seed,
+		ScopeException:  task.ScopeException,
+		Depth:           task.Depth,
+		LastMod:         task.LastMod,
+		SitemapPriority: task.Priority,
+		FetchError:      fetchErr.Error(),
+		CrawledAt:       time.Now(),
+	}
+	return c.store.SavePage(&page, storage.PageDetails{}, c.config.OnRecrawl)
+}
+
+// saveEdges records the distinct links found on a page. Links to the
+// same URL with different anchor texts or rels are kept apart.
+func (c *Crawler) saveEdges(fromURL string, links []parser.Link) error {
+	var fromHost string
+	if u, err := url.Parse(fromURL); err == nil {
+		fromHost = u.Hostname()
+	}
+
+	seen := make(map[parser.Link]bool, len(links))
+	edges := make([]storage.Edge, 0, len(links))
+	for _, link := range links {
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		edge := storage.Edge{RunID: c.config.RunID, FromURL: fromURL, ToURL: link.URL, Text: link.Text, Rel: link.Rel}
+		if u, err := url.Parse(link.URL); err == nil {
+			edge.Internal = strings.EqualFold(u.Hostname(), fromHost)
+		}
+		edges = append(edges, edge)
+	}
+	return c.store.SaveEdges(edges)
+}
+
+// pageDetails returns the rows stored with a page: its resources, its
+// h1-h6 outline in document order and, with -anchor-details, its in-page
+// #anchor links.
+func (c *Crawler) pageDetails(data parser.SEOData) storage.PageDetails {
+	var details storage.PageDetails
+	for _, ref := range data.Resources {
+		details.Resources = append(details.Resources, storage.Resource{
+			Kind:   ref.Kind,
+			Inline: ref.Inline,
+			URL:    ref.URL,
+			Size:   ref.Size,
+		})
+	}
+	for i, ref := range data.Outline {
+		details.Headings = append(details.Headings, storage.Heading{
+			Level:    ref.Level,
+			Position: i,
+			Text:     ref.Text,
+		})
+	}
+	if !c.config.AnchorDetails {
+		return details
+	}
+	for _, ref := range data.Anchors {
+		details.AnchorLinks = append(details.AnchorLinks, storage.AnchorLink{
+			Fragment: ref.Fragment,
+			Text:     ref.Text,
+			Missing:  ref.Missing,
+		})
+	}
+	return details
+}
+
+func encodeMeta(meta map[string]string) string {
+	if len(meta) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// ============================================================================
+// PAGE CHECKS
+// ============================================================================
+
+// isLongRedirect flags pages reached through more redirects than
+// -redirect-hops-warn. They were fetched fine; the chain is just too long.
+func (c *Crawler) isLongRedirect(hops int) bool {
+	return c.config.RedirectHopsWarn > 0 && hops > c.config.RedirectHopsWarn
+}
+
+// isThinContent flags successful pages whose body has fewer words than
+// the configured minimum. Thin pages are kept, only marked for review.
+func (c *Crawler) isThinContent(data parser.SEOData) bool {
+	if c.config.ThinWords <= 0 || data.StatusCode < 200 || data.StatusCode > 299 {
+		return false
+	}
+	return data.WordCount < c.config.ThinWords
+}
+
+// headingDensity flags successful pages whose structure looks off:
+// "too-many" when there is a heading for fewer than -heading-words words
+// (a page of mostly headings), "none" when a page of at least
+// -heading-min-words words has no heading at all. Either check is
+// disabled by setting its flag to 0.
+func (c *Crawler) headingDensity(data parser.SEOData) string {
+	if data.StatusCode < 200 || data.StatusCode > 299 {
+		return ""
+	}
+	switch {
+	case c.config.HeadingWords > 0 && data.Headings > 1 && data.WordCount < data.Headings*c.config.HeadingWords:
+		return "too-many"
+	case c.config.HeadingMinWords > 0 && data.Headings == 0 && data.WordCount >= c.config.HeadingMinWords:
+		return "none"
+	}
+	return ""
+}
+
+// canonicalMismatch reports whether a page declares both a canonical URL
+// and an og:url that still differ after normalization.
+func (c *Crawler) canonicalMismatch(data parser.SEOData) bool {
+	if data.Canonical == "" || data.OGURL == "" {
+		return false
+	}
+	return !c.normalizer.Same(data.Canonical, data.OGURL)
+}
+
+// classifyPage returns the page type with -classify or -page-type, and ""
+// otherwise.
+func (c *Crawler) classifyPage(data parser.SEOData) string {
+	if !c.config.Classify && len(c.config.PageTypeRules) == 0 {
+		return ""
+	}
+	return parser.ClassifyPage(data, c.config.PageTypeRules)
+}
+
+// followsRobotsDirectives reports whether discovery follows the links of
+// a page with data's robots directives: not on nofollow pages with
+// -respect-nofollow, nor on noindex pages with -follow-noindex=false.
+func (c *Crawler) followsRobotsDirectives(data parser.SEOData) bool {
+	return !(c.config.RespectNofollow && data.Nofollow) && (c.config.FollowNoindex || !data.Noindex)
+}
+
+// ============================================================================
+// CRAWL STATS
+// ============================================================================
+
+// saveCrawlStats writes the current counters to the run's stats row,
+// inserting it on the first call and updating it afterwards. partial is
+// set while the crawl is still running.
+func (c *Crawler) saveCrawlStats(stats *storage.CrawlStats, duration time.Duration, partial bool) error {
+	stats.TotalPages = int(c.counts.completed.Load())
+	stats.SuccessPages = int(c.counts.success.Load())
+	stats.FailedPages = int(c.counts.failed.Load())
+	stats.Duration = int64(duration.Seconds())
+	stats.RunID = c.config.RunID
+	stats.Partial = partial
+	stats.CrawledAt = time.Now()
+
+	return c.store.SaveStats(stats)
+}
+
+// flushCrawlStats saves partial stats every interval until stop is
+// closed, so a crash keeps the progress so far and dashboards can follow
+// a running crawl.
+func (c *Crawler) flushCrawlStats(stats *storage.CrawlStats, startTime time.Time, interval time.Duration, stop <-chan struct{}, flushed chan<- struct{}) {
+	defer close(flushed)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.saveCrawlStats(stats, time.Since(startTime), true); err != nil {
+				slog.Error("failed to flush crawl stats", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package crawler
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"crawl-guardian.com/parser"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ============================================================================
+// CRAWL SCOPE
+// ============================================================================
+
+// Scope modes, see -scope and WithScope.
+const (
+	ScopeAny        = "any"        // follow every link
+	ScopeHost       = "host"       // stay on the seed's host
+	ScopeSubdomains = "subdomains" // the seed's host and its subdomains
+	ScopeDomain     = "domain"     // the seed's registered domain, any subdomain
+)
+
+// ScopeModes lists the valid -scope values.
+var ScopeModes = []string{ScopeAny, ScopeHost, ScopeSubdomains, ScopeDomain}
+
+// crawlScope decides which discovered links are followed. Scope
+// exceptions let an otherwise restricted crawl follow links to listed
+// domains (and their subdomains) or links carrying a listed rel, such as
+// hreflang alternates; pages reached that way are marked as exceptions.
+//
+// With -max-hosts, links to hosts beyond the first N distinct hosts seen
+// (the seed's included) are skipped, while known hosts keep being crawled.
+type crawlScope struct {
+	mode         string
+	seedHost     string
+	seedDomain   string // registered domain of seedHost, e.g. example.co.uk
+	allowDomains []string
+	allowRels    []string
+	filters      *urlFilter
+
+	respectNofollow bool
+	subtree         bool
+
+	maxHosts    int
+	mu          sync.Mutex
+	hosts       map[string]bool
+	hostsLogged bool
+}
+
+func (c *Crawler) newCrawlScope(seedURL string) *crawlScope {
+	s := &crawlScope{
+		mode:            c.config.Scope,
+		allowRels:       c.config.ScopeAllowRels,
+		filters:         c.filters,
+		respectNofollow: c.config.RespectNofollow,
+		subtree:         c.config.Subtree,
+		maxHosts:        c.config.MaxHosts,
+		hosts:           make(map[string]bool),
+	}
+	if u, err := url.Parse(seedURL); err == nil {
+		s.seedHost = strings.ToLower(u.Hostname())
+		s.hosts[s.seedHost] = true
+		// Hosts without a public suffix, like localhost or an IP, are
+		// their own domain.
+		s.seedDomain = s.seedHost
+		if d, err := publicsuffix.EffectiveTLDPlusOne(s.seedHost); err == nil {
+			s.seedDomain = d
+		}
+	}
+	for _, d := range c.config.ScopeAllowDomains {
+		s.allowDomains = append(s.allowDomains, strings.ToLower(strings.TrimPrefix(d, ".")))
+	}
+	return s
+}
+
+// Follow returns the task for link, found on page from, if discovery
+// may follow it. With -respect-nofollow, rel="nofollow" links never are,
+// and neither are links turned away by -include and -exclude.
+func (s *crawlScope) Follow(from string, link parser.Link) (crawlTask, bool) {
+	task := crawlTask{URL: link.URL}
+	if s.respectNofollow && parser.HasToken(link.Rel, "nofollow") {
+		return task, false
+	}
+	if !s.filters.Allowed(link.URL) {
+		return task, false
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return task, false
+	}
+	if s.inScope(u) && (!s.subtree || inSubtree(from, u)) {
+		return task, s.admitHost(u)
+	}
+
+	if s.exception(u, link.Rel) {
+		task.ScopeException = true
+		return task, s.admitHost(u)
+	}
+	return task, false
+}
+
+// admitHost reports whether u's host is known or there is still room
+// for a new one under -max-hosts. The first time a new host is turned
+// away, the hosts in scope are logged.
+func (s *crawlScope) admitHost(u *url.URL) bool {
+	if s.maxHosts <= 0 {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts[host] {
+		return true
+	}
+	if len(s.hosts) < s.maxHosts {
+		s.hosts[host] = true
+		return true
+	}
+
+	if !s.hostsLogged {
+		s.hostsLogged = true
+		hosts := make([]string, 0, len(s.hosts))
+		for h := range s.hosts {
+			hosts = append(hosts, h)
+		}
+		slices.Sort(hosts)
+		slog.Warn("host limit reached, skipping links to new hosts",
+			"max_hosts", s.maxHosts, "hosts", strings.Join(hosts, ","), "first_skipped", host)
+	}
+	return false
+}
+
+func (s *crawlScope) inScope(u *url.URL) bool {
+	switch s.mode {
+	case ScopeHost:
+		return strings.EqualFold(u.Hostname(), s.seedHost)
+	case ScopeSubdomains:
+		return underDomain(u, s.seedHost)
+	case ScopeDomain:
+		return underDomain(u, s.seedDomain)
+	default:
+		return true
+	}
+}
+
+func (s *crawlScope) exception(u *url.URL, rel string) bool {
+	for _, d := range s.allowDomains {
+		if underDomain(u, d) {
+			return true
+		}
+	}
+	return parser.HasAnyToken(rel, s.allowRels)
+}
+
+// underDomain reports whether u's host is domain or one of its subdomains.
+func underDomain(u *url.URL, domain string) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// inSubtree reports whether u lies below the directory of page from on
+// the same host: from /docs/a/ or /docs/a/index.html, only /docs/a/...
+// qualifies.
+func inSubtree(from string, u *url.URL) bool {
+	f, err := url.Parse(from)
+	if err != nil || !strings.EqualFold(f.Host, u.Host) {
+		return false
+	}
+
+	dir := f.Path
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		dir = dir[:i+1]
+	} else {
+		dir = "/"
+	}
+	return strings.HasPrefix(u.Path, dir)
+}
@@ -0,0 +1,534 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// DISCOVERY
+// ============================================================================
+
+// expandPage fetches a page for discovery and returns its links, and
+// whether its robots directives let discovery follow them. Nothing is
+// returned for failed pages or pages whose path has been abandoned.
+// Error pages and pages whose body couldn't be read are still handed
+// on, so links to them can be reported as broken.
+//
+// The response goes to the workers with the task, its body buffered, so
+// each page is only fetched once.
+func (c *Crawler) expandPage(ctx context.Context, task crawlTask, worklist chan<- crawlTask, streaks *emptyStreakTracker) ([]parser.Link, bool) {
+	url := task.URL
+	// The -autotune slot is held until the body is read, not while the
+	// page waits for a worker.
+	release := c.requestSlot()
+	defer release()
+	fetchStart := time.Now()
+	resp, err := c.client.Get(ctx, url)
+	c.observeRequest(time.Since(fetchStart), resp, err)
+	if err != nil {
+		release()
+		if unreachable(ctx, err) {
+			// Recorded by the workers, so links to it show up as broken.
+			task.FetchErr = err
+			worklist <- task
+		}
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	task.Response = resp
+	if c.client.TooLarge(resp) {
+		// Scraped (and recorded as skipped) without following its links.
+		task.FetchTime = time.Since(fetchStart)
+		release()
+		worklist <- task
+		return nil, false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	release()
+	if err != nil {
+		// Recorded by the workers as failed, like a failed request.
+		task.Response = nil
+		task.FetchErr = fmt.Errorf("read failed: %w", err)
+		task.FetchTime = time.Since(fetchStart)
+		worklist <- task
+		return nil, false
+	}
+	task.FetchTime = time.Since(fetchStart)
+	task.Truncated = fetch.Truncated(resp.Body)
+	fetch.FinishTimings(resp.Request)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	worklist <- task // Add to worklist for scraping
+	if resp.StatusCode == http.StatusNotModified && c.revalidate != nil {
+		// Unchanged since the earlier run: follow the links it had then.
+		prev, err := c.revalidate.Previous(url)
+		if err != nil || prev == nil {
+			return nil, false
+		}
+		links, followable, err := c.revalidate.Links(prev)
+		if err != nil {
+			slog.Error("failed to load previous links", "url", url, "error", err)
+			return nil, false
+		}
+		return links, followable
+	}
+	if resp.StatusCode != 200 {
+		return nil, false
+	}
+
+	if !fetch.IsHTML(fetch.ContentType(resp, body)) {
+		return nil, false
+	}
+	if streaks != nil && streaks.Record(url, parser.VisibleText(bytes.NewReader(body))) {
+		return nil, false
+	}
+
+	var directives parser.SEOData
+	parser.AddHeaderRobotsDirectives(&directives, resp.Header, c.config.RobotsUA)
+	links := parser.ExtractLinks(bytes.NewReader(body), url, c.config.ScopeAllowRels, c.normalizer, &directives)
+	return links, c.followsRobotsDirectives(directives)
+}
+
+// unreachable reports whether a request error means the URL itself
+// couldn't be fetched, as opposed to the crawl holding back: robots.txt,
+// budgets and cancellation don't make a link broken.
+func unreachable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil &&
+		!errors.Is(err, fetch.ErrDisallowed) &&
+		!errors.Is(err, fetch.ErrByteBudget) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// ============================================================================
+// SCRAPING
+// ============================================================================
+
+// crawlTask is a URL handed to the workers, along with anything its
+// source already knows about it.
+type crawlTask struct {
+	URL      string
+	LastMod  *time.Time // sitemap <lastmod>, when listed in a sitemap
+	Priority *float64   // sitemap <priority>, when listed in a sitemap
+	Seed     bool       // the -url discovery started from
+
+	ScopeException bool // out of scope, followed through a scope exception
+	Depth          int  // link hops from the seed; seeds and sitemap URLs are 0
+
+	// Response is set when discovery already fetched the page, with the
+	// body buffered, so the worker doesn't fetch it again.
+	Response  *http.Response
+	FetchTime time.Duration
+	Truncated bool  // the buffered body was cut off at -max-body-bytes
+	FetchErr  error // discovery's request failed; the worker records it
+}
+
+// followsLinks reports whether discovery follows the links on task's
+// page, which it doesn't at -max-depth.
+func (c *Crawler) followsLinks(t crawlTask) bool {
+	return c.config.MaxDepth <= 0 || t.Depth < c.config.MaxDepth
+}
+
+// addRequestFacts fills in what the request of resp tells about the page:
+// attempts, rendering, timings and, with -record-egress, where it left
+// from.
+func (c *Crawler) addRequestFacts(data *parser.SEOData, resp *http.Response) {
+	data.Attempts = fetch.Attempts(resp.Request)
+	data.Rendered = fetch.Rendered(resp.Request)
+	if t, ok := c.client.Timings(resp.Request); ok {
+		data.DNSMillis, data.ConnectMillis, data.TLSMillis = t.DNS, t.Connect, t.TLS
+		data.TTFBMillis, data.TotalMillis = t.TTFB, t.Total
+	}
+	data.LocalIP, data.Proxy = fetch.Egress(resp.Request)
+}
+
+func (c *Crawler) scrapeURLFromWorklist(ctx context.Context, task crawlTask, p parser.Parser) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Pages fetched by discovery come with their response; the others,
+	// such as -seed-csv and sitemap seeds, are fetched here.
+	resp, err := task.Response, task.FetchErr
+	release := func() {}
+	if resp == nil && err == nil {
+		release = c.requestSlot()
+		defer release()
+		fetchStart := time.Now()
+		resp, err = c.client.Get(ctx, task.URL)
+		c.observeRequest(time.Since(fetchStart), resp, err)
+	}
+	if err != nil {
+		c.counts.failed.Add(1)
+		if unreachable(ctx, err) {
+			if err := c.saveFailedPage(task, err); err != nil {
+				slog.Error("failed to record failed page", "url", task.URL, "error", err)
+			}
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && c.revalidate != nil {
+		pageURL, _ := parser.RedirectSource(resp)
+		prev, err := c.revalidate.Previous(pageURL)
+		if err != nil {
+			c.counts.failed.Add(1)
+			return fmt.Errorf("db lookup failed: %w", err)
+		}
+		if prev != nil {
+			if err := c.reuseUnchanged(prev, task); err != nil {
+				c.counts.failed.Add(1)
+				return fmt.Errorf("db insert failed: %w", err)
+			}
+			return nil
+		}
+	}
+
+	if c.client.TooLarge(resp) {
+		if err := c.saveSkippedPage(task, resp, "too-large", fetch.ContentType(resp, nil), 0); err != nil {
+			c.counts.failed.Add(1)
+			return fmt.Errorf("db insert failed: %w", err)
+		}
+		slog.Info("skipped page", "url", task.URL, "reason", "too-large", "content_length", resp.ContentLength)
+		c.counts.skipped.Add(1)
+		if _, hops := parser.RedirectSource(resp); c.isLongRedirect(hops) {
+			c.counts.longRedirects.Add(1)
+		}
+		c.counts.completed.Add(1)
+		return nil
+	}
+
+	// The body is buffered for the content hash and the filesystem mirror.
+	rawHTML, err := io.ReadAll(resp.Body)
+	release()
+	if err != nil {
+		c.counts.failed.Add(1)
+		return fmt.Errorf("read failed: %w", err)
+	}
+	fetch.FinishTimings(resp.Request)
+	truncated := task.Truncated || fetch.Truncated(resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(rawHTML))
+	hash := parser.ContentHash(rawHTML)
+	bodySize := int64(len(rawHTML))
+
+	contentType := fetch.ContentType(resp, rawHTML)
+	if !fetch.IsHTML(contentType) {
+		if err := c.saveSkippedPage(task, resp, "not-html", contentType, int64(len(rawHTML))); err != nil {
+			c.counts.failed.Add(1)
+			return fmt.Errorf("db insert failed: %w", err)
+		}
+		slog.Info("skipped page", "url", task.URL, "reason", "not-html", "content_type", contentType)
+		c.counts.skipped.Add(1)
+		if _, hops := parser.RedirectSource(resp); c.isLongRedirect(hops) {
+			c.counts.longRedirects.Add(1)
+		}
+		c.counts.completed.Add(1)
+		return nil
+	}
+
+	if c.config.HashGate {
+		pageURL, _ := parser.RedirectSource(resp)
+		prev, err := c.previousPage(pageURL)
+		if err != nil {
+			c.counts.failed.Add(1)
+			return fmt.Errorf("db lookup failed: %w", err)
+		}
+		if prev != nil && prev.ContentHash == hash && prev.StatusCode == resp.StatusCode {
+			if err := c.reuseUnchanged(prev, task); err != nil {
+				c.counts.failed.Add(1)
+				return fmt.Errorf("db insert failed: %w", err)
+			}
+			return nil
+		}
+		if prev != nil {
+			c.counts.changed.Add(1)
+		}
+	}
+	if !c.config.OutHTML {
+		rawHTML = nil
+	}
+
+	data, err := p.GetSEOData(resp)
+	if err != nil {
+		c.counts.failed.Add(1)
+		return fmt.Errorf("parse failed: %w", err)
+	}
+	c.addRequestFacts(&data, resp)
+	data.ContentHash = hash
+	data.ContentType = contentType
+	data.ContentLength = resp.ContentLength
+	data.BodyBytes = bodySize
+	data.Truncated = truncated
+	data.LastMod = task.LastMod
+	data.SitemapPriority = task.Priority
+	data.Seed = task.Seed
+	data.ScopeException = task.ScopeException
+	data.Depth = task.Depth
+
+	if c.config.OutDir != "" {
+		if err := writeMirrorFiles(c.config.OutDir, data, rawHTML); err != nil {
+			slog.Error("failed to mirror page", "url", data.URL, "error", err)
+		}
+	}
+
+	if c.writer != nil {
+		c.writer.Save(data)
+	} else if err := c.savePage(c.store, data); err != nil {
+		c.counts.failed.Add(1)
+		return fmt.Errorf("db insert failed: %w", err)
+	}
+
+	if c.isThinContent(data) {
+		c.counts.thin.Add(1)
+	}
+	if c.isLongRedirect(data.RedirectHops) {
+		c.counts.longRedirects.Add(1)
+	}
+
+	c.counts.success.Add(1)
+	c.counts.completed.Add(1)
+	return nil
+}
+
+func (c *Crawler) worker(ctx context.Context, id int, worklist <-chan crawlTask, wg *sync.WaitGroup) {
+	defer wg.Done()
+	p := c.newParser()
+	for task := range worklist {
+		// Once canceled, pages discovery already fetched are still saved,
+		// the rest are drained without fetching.
+		if ctx.Err() != nil && task.Response == nil {
+			continue
+		}
+		if c.progress != nil {
+			c.progress.Begin(id, task.URL)
+		}
+		if err := c.scrapeURLFromWorklist(ctx, task, p); err != nil {
+			log.Printf("failed to scrape %s: %v", task.URL, err)
+			if task.Seed {
+				seedErr := fmt.Errorf("failed to crawl seed %s: %w", task.URL, err)
+				c.counts.seedErr.Store(&seedErr)
+			}
+		}
+		if c.progress != nil {
+			c.progress.End(id)
+		}
+	}
+}
+
+// ============================================================================
+// CRAWL
+// ============================================================================
+
+// runCrawl crawls the config's seed URL (or the configured seed source)
+// into the config's run and saves its stats. Once ctx is canceled,
+// queued pages are dropped and discovery winds down.
+func (c *Crawler) runCrawl(ctx context.Context) (storage.CrawlStats, error) {
+	startTime := time.Now()
+	db, config := c.db, c.config
+
+	id, err := storage.BeginCrawl(db, config.RunID)
+	if err != nil {
+		return storage.CrawlStats{}, fmt.Errorf("failed to register crawl: %w", err)
+	}
+	c.crawlID = id
+
+	// Setup worklist channel
+	worklist := make(chan crawlTask, 100)
+	done := make(chan bool)
+
+	// Start workers
+	var wg sync.WaitGroup
+	numWorkers := config.Workers
+
+	stopTuner := make(chan struct{})
+	c.tuner = nil
+	if config.AutoTune {
+		c.tuner = newConcurrencyTuner(config.MinWorkers, config.MaxWorkers,
+			config.AutoTuneMaxErrorRate, config.AutoTuneMaxLatency)
+		numWorkers = max(config.MaxWorkers, config.MinWorkers)
+		go c.tuner.run(db, config.RunID, config.AutoTuneInterval, stopTuner)
+	}
+
+	if config.DBBatch > 0 {
+		interval := config.DBFlushInterval
+		if interval == 0 {
+			interval = defaultBatchInterval
+		}
+		c.writer = newBatchWriter(c, interval, config.DBBatch)
+	} else if config.DBFlushInterval > 0 {
+		c.writer = newPageWriter(c, config.DBFlushInterval, config.DBMaxBatch)
+	}
+	if c.writer != nil {
+		defer func() {
+			if c.writer != nil {
+				c.writer.Close()
+				c.writer = nil
+			}
+		}()
+	}
+
+	if !config.Quiet && isTerminal(os.Stderr) {
+		c.progress = startProgress(os.Stderr, c.counts, numWorkers, config.MaxPages, func() int { return len(worklist) })
+		log.SetOutput(c.progress)
+		// Workers are done by the time this runs, however the crawl ends.
+		defer c.stopProgress()
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go c.worker(ctx, i, worklist, &wg)
+	}
+
+	// Discover & feed URLs
+	seedURL := config.SeedURL
+	maxURLs := config.MaxPages
+
+	if config.SeedCSV != "" {
+		urls, err := c.loadSeedCSV(config.SeedCSV, config.CSVColumn, config.CSVBaseURL)
+		if err != nil {
+			close(worklist)
+			wg.Wait()
+			close(stopTuner)
+			return storage.CrawlStats{}, fmt.Errorf("failed to load seed csv: %w", err)
+		}
+		seedURL = config.SeedCSV
+		go c.seedWorklist(ctx, tasksFromURLs(urls), maxURLs, worklist, done)
+	} else if config.SitemapURL != "" && !config.WithSitemap {
+		tasks, err := c.loadSitemapSeeds(ctx, config.SitemapURL, config.Since, config.IncludeNoLastMod)
+		if err != nil {
+			close(worklist)
+			wg.Wait()
+			close(stopTuner)
+			return storage.CrawlStats{}, fmt.Errorf("failed to load sitemap: %w", err)
+		}
+		seedURL = config.SitemapURL
+		go c.seedWorklist(ctx, tasks, maxURLs, worklist, done)
+	} else if config.APIURL != "" {
+		seedURL = config.APIURL
+		go c.crawlAPI(ctx, worklist, maxURLs, done)
+	} else if config.StreamDiscovery {
+		frontier := newDiskFrontier(db, config.RunID)
+		var known int64
+		if config.Resume != "" {
+			var pending int64
+			var err error
+			known, pending, err = frontier.Resume()
+			if err == nil && known == 0 {
+				err = fmt.Errorf("run %s has no stored frontier", config.Resume)
+			}
+			if err != nil {
+				close(worklist)
+				wg.Wait()
+				close(stopTuner)
+				return storage.CrawlStats{}, fmt.Errorf("failed to resume: %w", err)
+			}
+			log.Printf("Resuming run %s: %d URLs known, %d pending", config.RunID, known, pending)
+		}
+		go c.discoverURLs(ctx, seedURL, worklist, maxURLs, int(known), done, frontier)
+	} else {
+		go c.discoverURLs(ctx, seedURL, worklist, maxURLs, 0, done, newMemoryFrontier(c.client.HostBusy))
+	}
+
+	stats := &storage.CrawlStats{StartURL: seedURL}
+	if config.RecordEgress {
+		if ip, err := c.client.LookupEgressIP(ctx, config.EgressEchoURL); err != nil {
+			slog.Warn("failed to look up egress IP", "error", err)
+		} else {
+			stats.EgressIP = ip
+			log.Printf("Egress IP: %s", ip)
+		}
+	}
+	stopStats := make(chan struct{})
+	statsFlushed := make(chan struct{})
+	if config.StatsInterval > 0 {
+		go c.flushCrawlStats(stats, startTime, config.StatsInterval, stopStats, statsFlushed)
+	} else {
+		close(statsFlushed)
+	}
+
+	// Wait for discovery to finish
+	<-done
+	close(worklist)
+	wg.Wait()
+	c.stopProgress()
+	if c.writer != nil {
+		c.writer.Close()
+		c.writer = nil
+	}
+	if err := storage.UpdateInboundLinks(db, config.RunID); err != nil {
+		slog.Error("failed to count inbound links", "error", err)
+	}
+	if err := storage.UpdateBrokenLinks(db, config.RunID); err != nil {
+		slog.Error("failed to collect broken links", "error", err)
+	}
+	if err := storage.UpdateDuplicates(db, config.RunID); err != nil {
+		slog.Error("failed to collect duplicate titles and descriptions", "error", err)
+	}
+	if err := c.logPageChanges(seedURL); err != nil {
+		slog.Error("failed to compare with the previous run", "error", err)
+	}
+	close(stopTuner)
+	close(stopStats)
+	<-statsFlushed
+	if err := storage.FinishCrawl(db, c.crawlID); err != nil {
+		slog.Error("failed to finish crawl", "error", err)
+	}
+
+	// Save stats
+	duration := time.Since(startTime)
+	stats.Interrupted = ctx.Err() != nil
+	if err := storage.AddResponseStats(db, stats, config.RunID); err != nil {
+		slog.Error("failed to aggregate response times", "error", err)
+	}
+	if err := c.saveCrawlStats(stats, duration, false); err != nil {
+		slog.Error("failed to save crawl stats", "error", err)
+	}
+
+	counts := c.counts
+	status := "complete"
+	if stats.Interrupted {
+		status = "interrupted"
+	}
+	log.Printf("Scraping %s! Run: %s, Success: %d, Failed: %d, Skipped: %d, Thin: %d, Long redirects: %d, Bytes: %d, Duration: %v",
+		status, config.RunID, counts.success.Load(), counts.failed.Load(), counts.skipped.Load(), counts.thin.Load(),
+		counts.longRedirects.Load(), c.client.BytesDownloaded(), duration)
+	if stats.TimedPages > 0 {
+		log.Printf("Response times: avg %d ms, p50 %d ms, p90 %d ms, p99 %d ms, avg TTFB %d ms, avg body %d bytes",
+			stats.AvgResponseMillis, stats.P50ResponseMillis, stats.P90ResponseMillis, stats.P99ResponseMillis,
+			stats.AvgTTFBMillis, stats.AvgBodyBytes)
+	}
+	if c.client.Rendering() {
+		log.Printf("Rendered with headless Chrome: %d pages", c.client.RenderedPages())
+	}
+	if config.HashGate {
+		log.Printf("Compared to previous runs: %d changed, %d unchanged (not re-extracted), %d new",
+			counts.changed.Load(), counts.unchanged.Load(), counts.success.Load()-counts.changed.Load()-counts.unchanged.Load())
+	} else if config.Revalidate {
+		log.Printf("Compared to previous runs: %d not modified (not downloaded)", counts.unchanged.Load())
+	}
+	if stats.Interrupted && config.StreamDiscovery {
+		log.Printf("Continue with -resume %s", config.RunID)
+	}
+	// With nothing crawled, a failed seed is the crawl's error rather
+	// than a complete run with no pages.
+	if seedErr := counts.seedErr.Load(); seedErr != nil && counts.success.Load() == 0 && ctx.Err() == nil {
+		return *stats, *seedErr
+	}
+	return *stats, ctx.Err()
+}
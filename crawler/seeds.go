@@ -0,0 +1,241 @@
+package crawler
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"crawl-guardian.com/parser"
+)
+
+// ============================================================================
+// SEED IMPORT
+// ============================================================================
+
+// Column names used by common URL exports, checked in order when no
+// column is configured.
+var knownURLColumns = []string{
+	"url", "urls", "top pages", "page", "pages", "landing page",
+	"page path", "address", "loc", "link",
+}
+
+// loadSeedCSV reads the URL column of a CSV export. column is either a
+// header name (case-insensitive) or a 1-based column number; when empty
+// the column is detected from the header or the first row holding a URL.
+// Duplicate and malformed rows are skipped and counted in the log.
+func (c *Crawler) loadSeedCSV(path, column, baseURL string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open seed csv: %w", err)
+	}
+	defer f.Close()
+
+	var base *url.URL
+	if baseURL != "" {
+		base, err = url.Parse(baseURL)
+		if err != nil || !base.IsAbs() {
+			return nil, fmt.Errorf("invalid csv base url %q", baseURL)
+		}
+	}
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	first, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("seed csv %s is empty", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed csv: %w", err)
+	}
+	if len(first) > 0 {
+		first[0] = strings.TrimPrefix(first[0], "\ufeff")
+	}
+
+	hasHeader := isCSVHeader(first, column)
+	index, err := resolveCSVColumn(first, column, hasHeader, base, c.normalizer)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	duplicates, malformed := 0, 0
+
+	add := func(record []string) {
+		if index >= len(record) {
+			malformed++
+			return
+		}
+		link, ok := parseSeedURL(record[index], base, c.normalizer)
+		if !ok {
+			malformed++
+			return
+		}
+		if seen[link] {
+			duplicates++
+			return
+		}
+		seen[link] = true
+		urls = append(urls, link)
+	}
+
+	if !hasHeader {
+		add(first)
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			malformed++
+			continue
+		}
+		add(record)
+	}
+
+	slog.Info("loaded seed csv", "file", path, "urls", len(urls),
+		"duplicates", duplicates, "malformed", malformed)
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("seed csv %s contains no usable URLs", path)
+	}
+	return urls, nil
+}
+
+// A row is treated as a header when one of its cells is a known URL
+// column name, or the column -csv-column names. Other rows, such as a
+// first row of relative paths, are data.
+func isCSVHeader(record []string, column string) bool {
+	for _, cell := range record {
+		cell = strings.TrimSpace(cell)
+		if column != "" && strings.EqualFold(cell, column) {
+			return true
+		}
+		for _, known := range knownURLColumns {
+			if strings.EqualFold(cell, known) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func resolveCSVColumn(first []string, column string, hasHeader bool, base *url.URL, n parser.Normalizer) (int, error) {
+	if column != "" {
+		if n, err := strconv.Atoi(column); err == nil {
+			if n < 1 {
+				return 0, fmt.Errorf("csv column number must be 1 or greater, got %d", n)
+			}
+			return n - 1, nil
+		}
+		if !hasHeader {
+			return 0, fmt.Errorf("csv column %q given by name but the file has no header row", column)
+		}
+		for i, name := range first {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("csv column %q not found in header %v", column, first)
+	}
+
+	if hasHeader {
+		for _, known := range knownURLColumns {
+			for i, name := range first {
+				if strings.EqualFold(strings.TrimSpace(name), known) {
+					return i, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("no URL column found in header %v, set -csv-column", first)
+	}
+
+	for i, cell := range first {
+		if _, ok := parseSeedURL(cell, base, n); ok {
+			return i, nil
+		}
+	}
+	return 0, errors.New("no URL column found, set -csv-column")
+}
+
+func parseSeedURL(raw string, base *url.URL, n parser.Normalizer) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if !u.IsAbs() {
+		if base == nil {
+			return "", false
+		}
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+
+	return n.OrRaw(u.String()), true
+}
+
+func tasksFromURLs(urls []string) []crawlTask {
+	tasks := make([]crawlTask, len(urls))
+	for i, u := range urls {
+		tasks[i] = crawlTask{URL: u}
+	}
+	return tasks
+}
+
+// seedWorklist hands seed tasks to the workers, holding them to the same
+// rules as discovered links: -include and -exclude, robots.txt and, for
+// those left, -max-pages. With -resume, seeds the run already saved are
+// skipped.
+func (c *Crawler) seedWorklist(ctx context.Context, tasks []crawlTask, maxURLs int, worklist chan<- crawlTask, done chan<- bool) {
+	queued, filtered, disallowed, stored, overLimit := 0, 0, 0, 0, 0
+	for i, task := range tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		// Seeds a resumed run already saved count too.
+		if queued+stored >= maxURLs {
+			overLimit = len(tasks) - i
+			break
+		}
+		if !c.filters.Allowed(task.URL) {
+			filtered++
+			continue
+		}
+		if c.config.Resume != "" {
+			if saved, err := c.store.HasURL(c.config.RunID, c.normalizer.OrRaw(task.URL)); err == nil && saved {
+				stored++
+				continue
+			}
+		}
+		// Disallowed URLs don't count towards -max-pages.
+		if allowed, err := c.client.Allowed(ctx, task.URL); err != nil || !allowed {
+			disallowed++
+			continue
+		}
+		worklist <- task
+		queued++
+	}
+	if filtered > 0 || disallowed > 0 || stored > 0 || overLimit > 0 {
+		slog.Info("seeds skipped", "queued", queued, "filtered", filtered,
+			"disallowed", disallowed, "stored", stored, "over_max_pages", overLimit)
+	}
+	done <- true
+}
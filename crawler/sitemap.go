@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SITEMAP SEEDING
+// ============================================================================
+
+// Nested sitemap indexes deeper than this are ignored.
+const maxSitemapDepth = 3
+
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// W3C datetime variants allowed in <lastmod>.
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseLastMod(raw string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// loadSitemapSeeds fetches a sitemap (following sitemap indexes) and
+// returns its URLs as crawl tasks. With a non-zero since, only URLs whose
+// <lastmod> is after it are kept; URLs without a usable lastmod are kept
+// only when includeUndated is set. URLs turned away by -include and
+// -exclude are dropped.
+func (c *Crawler) loadSitemapSeeds(ctx context.Context, sitemapURL string, since time.Time, includeUndated bool) ([]crawlTask, error) {
+	entries, err := c.fetchSitemapEntries(ctx, sitemapURL, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []crawlTask
+	seen := make(map[string]bool)
+	skippedOld, skippedUndated, filtered := 0, 0, 0
+
+	for _, e := range entries {
+		link, ok := parseSeedURL(e.Loc, nil, c.normalizer)
+		if !ok || seen[link] {
+			continue
+		}
+		seen[link] = true
+		if !c.filters.Allowed(link) {
+			filtered++
+			continue
+		}
+
+		task := crawlTask{URL: link}
+		if t, ok := parseLastMod(e.LastMod); ok {
+			task.LastMod = &t
+		}
+		if p, err := strconv.ParseFloat(strings.TrimSpace(e.Priority), 64); err == nil && p >= 0 && p <= 1 {
+			task.Priority = &p
+		}
+
+		if !since.IsZero() {
+			switch {
+			case task.LastMod == nil && !includeUndated:
+				skippedUndated++
+				continue
+			case task.LastMod != nil && !task.LastMod.After(since):
+				skippedOld++
+				continue
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	slog.Info("loaded sitemap", "url", sitemapURL, "urls", len(tasks),
+		"not_modified_since", skippedOld, "without_lastmod", skippedUndated, "filtered", filtered)
+
+	if len(tasks) == 0 && since.IsZero() {
+		return nil, fmt.Errorf("sitemap %s contains no usable URLs", sitemapURL)
+	}
+	return tasks, nil
+}
+
+func (c *Crawler) fetchSitemapEntries(ctx context.Context, sitemapURL string, depth int) ([]sitemapEntry, error) {
+	resp, err := c.client.Get(ctx, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("sitemap %s returned status %d", sitemapURL, resp.StatusCode)
+	}
+
+	doc, err := decodeSitemap(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	if doc.XMLName.Local != "sitemapindex" {
+		return doc.URLs, nil
+	}
+
+	if depth >= maxSitemapDepth {
+		slog.Warn("sitemap index nested too deeply, skipping", "url", sitemapURL)
+		return nil, nil
+	}
+
+	var entries []sitemapEntry
+	for _, child := range doc.Sitemaps {
+		childEntries, err := c.fetchSitemapEntries(ctx, strings.TrimSpace(child.Loc), depth+1)
+		if err != nil {
+			slog.Warn("failed to load child sitemap", "url", child.Loc, "error", err)
+			continue
+		}
+		entries = append(entries, childEntries...)
+	}
+	return entries, nil
+}
+
+// decodeSitemap parses a sitemap or sitemap index, gunzipping it first if
+// it is compressed (sitemap.xml.gz is served as is, not with a
+// Content-Encoding the HTTP client would undo).
+func decodeSitemap(r io.Reader) (sitemapDocument, error) {
+	var doc sitemapDocument
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return doc, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	err := xml.NewDecoder(r).Decode(&doc)
+	return doc, err
+}
+
+// defaultSitemapURL returns /sitemap.xml on seedURL's host.
+func defaultSitemapURL(seedURL string) string {
+	u, err := url.Parse(seedURL)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/sitemap.xml"}).String()
+}
+
+// loadDiscoverySitemap loads the sitemap that -with-sitemap feeds into
+// link discovery: -sitemap, or /sitemap.xml on the seed's host. A missing
+// sitemap only costs the extra URLs, so errors are logged, not returned.
+func (c *Crawler) loadDiscoverySitemap(ctx context.Context, seedURL string) []crawlTask {
+	sitemapURL := c.config.SitemapURL
+	if sitemapURL == "" {
+		sitemapURL = defaultSitemapURL(seedURL)
+	}
+	tasks, err := c.loadSitemapSeeds(ctx, sitemapURL, c.config.Since, c.config.IncludeNoLastMod)
+	if err != nil {
+		slog.Warn("sitemap unavailable, discovering links only", "url", sitemapURL, "error", err)
+		return nil
+	}
+	return tasks
+}
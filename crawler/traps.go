@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"crawl-guardian.com/parser"
+)
+
+// ============================================================================
+// CRAWLER TRAP AVOIDANCE
+// ============================================================================
+
+// emptyStreakTracker stops discovery from expanding a path once it has
+// produced too many near-empty or duplicate pages in a row, which is the
+// usual signature of calendars and search-result permutations.
+type emptyStreakTracker struct {
+	mu        sync.Mutex
+	limit     int
+	minWords  int
+	paths     map[string]*pathStreak
+	abandoned map[string]bool
+}
+
+// pathStreak is the current streak of a path and the text hashes of its
+// last limit pages. A page is a duplicate when its text matches one of
+// them, so identical boilerplate on unrelated paths doesn't count, and
+// memory per path stays bounded however many pages it has.
+type pathStreak struct {
+	count  int
+	recent [][sha256.Size]byte
+	next   int // where the next hash goes once recent is full
+}
+
+func newEmptyStreakTracker(limit, minWords int) *emptyStreakTracker {
+	return &emptyStreakTracker{
+		limit:     limit,
+		minWords:  minWords,
+		paths:     make(map[string]*pathStreak),
+		abandoned: make(map[string]bool),
+	}
+}
+
+// Abandoned reports whether rawURL belongs to a path that was given up on.
+func (t *emptyStreakTracker) Abandoned(rawURL string) bool {
+	key, ok := streakKey(rawURL)
+	if !ok {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.abandoned[key]
+}
+
+// Record notes the outcome of a fetched page and reports whether its path
+// has just been abandoned.
+func (t *emptyStreakTracker) Record(rawURL, text string) bool {
+	key, ok := streakKey(rawURL)
+	if !ok {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(text))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ps := t.paths[key]
+	if ps == nil {
+		ps = &pathStreak{}
+		t.paths[key] = ps
+	}
+	duplicate := ps.add(hash, t.limit)
+
+	if !duplicate && parser.CountWords(text) >= t.minWords {
+		ps.count = 0
+		return false
+	}
+
+	ps.count++
+	if ps.count < t.limit || t.abandoned[key] {
+		return false
+	}
+
+	t.abandoned[key] = true
+	slog.Warn("abandoning path after consecutive empty or duplicate pages",
+		"path", key, "pages", ps.count, "last_url", rawURL)
+	return true
+}
+
+// add remembers hash among the last limit hashes of the path and reports
+// whether it was already there.
+func (ps *pathStreak) add(hash [sha256.Size]byte, limit int) bool {
+	for _, h := range ps.recent {
+		if h == hash {
+			return true
+		}
+	}
+	if len(ps.recent) < limit {
+		ps.recent = append(ps.recent, hash)
+		return false
+	}
+	ps.recent[ps.next] = hash
+	ps.next = (ps.next + 1) % len(ps.recent)
+	return false
+}
+
+// Pages are grouped by the endpoint for parameterised URLs
+// (/search?q=a, /search?q=b) and by parent directory otherwise
+// (/calendar/2024/01, /calendar/2024/02).
+func streakKey(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery == "" {
+		p = path.Dir(p)
+	}
+	return u.Host + p, true
+}
+
+// trapDetector recognises generative URLs such as /a/a/a/... or queries
+// that keep growing, so a single path can't consume the maxURLs budget.
+type trapDetector struct {
+	maxRepeat int
+	maxParams int
+
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+func newTrapDetector(maxRepeat, maxParams int) *trapDetector {
+	return &trapDetector{
+		maxRepeat: maxRepeat,
+		maxParams: maxParams,
+		reported:  make(map[string]bool),
+	}
+}
+
+// IsTrap reports whether rawURL looks generative, logging each distinct
+// pattern once per host.
+func (d *trapDetector) IsTrap(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	pattern := d.match(u)
+	if pattern == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	key := u.Host + " " + pattern
+	first := !d.reported[key]
+	d.reported[key] = true
+	d.mu.Unlock()
+
+	if first {
+		slog.Warn("crawler trap detected, not following", "host", u.Host, "pattern", pattern, "url", rawURL)
+	}
+	return true
+}
+
+func (d *trapDetector) match(u *url.URL) string {
+	if d.maxRepeat > 0 {
+		counts := make(map[string]int)
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment == "" {
+				continue
+			}
+			counts[segment]++
+			if counts[segment] > d.maxRepeat {
+				return fmt.Sprintf("path segment %q repeated more than %d times", segment, d.maxRepeat)
+			}
+		}
+	}
+
+	if u.RawQuery == "" {
+		return ""
+	}
+	query := u.Query()
+
+	if d.maxRepeat > 0 {
+		for key, values := range query {
+			if len(values) > d.maxRepeat {
+				return fmt.Sprintf("query param %q repeated more than %d times", key, d.maxRepeat)
+			}
+		}
+	}
+
+	if d.maxParams > 0 {
+		params := 0
+		for _, values := range query {
+			params += len(values)
+		}
+		if params > d.maxParams {
+			return fmt.Sprintf("query has more than %d params", d.maxParams)
+		}
+	}
+
+	return ""
+}
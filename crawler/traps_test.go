@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEmptyStreakDuplicatesPerPath(t *testing.T) {
+	page := strings.Repeat("word ", 100)
+	tr := newEmptyStreakTracker(3, 50)
+
+	// The same boilerplate under different paths is not a duplicate.
+	for i := range 10 {
+		if tr.Record(fmt.Sprintf("https://example.com/section%d/page", i), page) {
+			t.Fatalf("path %d abandoned for text first seen on other paths", i)
+		}
+	}
+
+	// Under one path, it is.
+	var abandoned bool
+	for i := range 3 {
+		abandoned = tr.Record(fmt.Sprintf("https://example.com/section0/page%d", i), page)
+	}
+	if !abandoned {
+		t.Error("path not abandoned after 3 duplicate pages in a row")
+	}
+	if !tr.Abandoned("https://example.com/section0/other") {
+		t.Error("Abandoned is false for a URL of the abandoned path")
+	}
+	if tr.Abandoned("https://example.com/section1/other") {
+		t.Error("Abandoned is true for a URL of another path")
+	}
+}
+
+func TestEmptyStreakResetByNewPage(t *testing.T) {
+	tr := newEmptyStreakTracker(3, 50)
+	for i := range 20 {
+		text := "thin"
+		if i%2 == 1 {
+			text = strings.Repeat(fmt.Sprintf("page%d ", i), 60)
+		}
+		if tr.Record(fmt.Sprintf("https://example.com/cal?d=%d", i), text) {
+			t.Fatalf("abandoned at page %d, though every other page is new and long", i)
+		}
+	}
+}
+
+func TestEmptyStreakMemoryBounded(t *testing.T) {
+	tr := newEmptyStreakTracker(5, 1)
+	for i := range 1000 {
+		tr.Record(fmt.Sprintf("https://example.com/search?q=%d", i), fmt.Sprintf("result %d", i))
+	}
+	ps := tr.paths["example.com/search"]
+	if ps == nil {
+		t.Fatal("no streak kept for the path")
+	}
+	if len(ps.recent) != 5 {
+		t.Errorf("kept %d hashes for the path, want the last 5", len(ps.recent))
+	}
+
+	// Only the last 5 pages count as seen.
+	if tr.Record("https://example.com/search?q=x", "result 999") {
+		t.Error("abandoned after one duplicate")
+	}
+	if ps.count != 1 {
+		t.Errorf("a repeat of the last page made the streak %d, want 1", ps.count)
+	}
+	if tr.Record("https://example.com/search?q=y", "result 0"); ps.count != 0 {
+		t.Errorf("a repeat of a page older than the last 5 made the streak %d, want 0", ps.count)
+	}
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"log/slog"
+	"time"
+
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+)
+
+// ============================================================================
+// PAGE WRITER
+// ============================================================================
+
+// pageWriter smooths database writes: scraped pages are queued and saved
+// in one transaction per -db-flush-interval, at most -db-max-batch pages
+// at a time. When more pages arrive than that rate allows, the queue
+// fills up and workers wait, so writes never burst. Pages still queued
+// when the process dies are lost.
+//
+// With -db-batch the writer batches for throughput instead: a batch is
+// saved as soon as it is full, and at least once per interval, so
+// workers only wait on the database when it can't keep up at all.
+type pageWriter struct {
+	crawler  *Crawler
+	interval time.Duration
+	maxBatch int
+	eager    bool // save full batches at once instead of at the next tick
+	queue    chan parser.SEOData
+	done     chan struct{}
+}
+
+// defaultBatchInterval is how often -db-batch saves a batch that isn't
+// full, unless -db-flush-interval says otherwise.
+const defaultBatchInterval = 2 * time.Second
+
+func newPageWriter(c *Crawler, interval time.Duration, maxBatch int) *pageWriter {
+	w := &pageWriter{
+		crawler:  c,
+		interval: interval,
+		maxBatch: max(maxBatch, 1),
+		done:     make(chan struct{}),
+	}
+	w.queue = make(chan parser.SEOData, w.maxBatch)
+	go w.run()
+	return w
+}
+
+// newBatchWriter returns a writer saving pages in transactions of up to
+// size pages, whenever that many are queued or interval has passed.
+func newBatchWriter(c *Crawler, interval time.Duration, size int) *pageWriter {
+	w := &pageWriter{
+		crawler:  c,
+		interval: interval,
+		maxBatch: max(size, 1),
+		eager:    true,
+		done:     make(chan struct{}),
+	}
+	w.queue = make(chan parser.SEOData, w.maxBatch)
+	go w.run()
+	return w
+}
+
+// Save queues a page, blocking while the queue is full.
+func (w *pageWriter) Save(data parser.SEOData) {
+	w.queue <- data
+}
+
+// Close saves everything still queued, without waiting for the interval,
+// and stops the writer.
+func (w *pageWriter) Close() {
+	close(w.queue)
+	<-w.done
+}
+
+func (w *pageWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]parser.SEOData, 0, w.maxBatch)
+	for {
+		// A full batch stops reading from the queue until the next tick.
+		queue := w.queue
+		if len(batch) >= w.maxBatch {
+			queue = nil
+		}
+
+		select {
+		case data, ok := <-queue:
+			if !ok {
+				for len(batch) > 0 {
+					n := min(len(batch), w.maxBatch)
+					w.flush(batch[:n])
+					batch = batch[n:]
+				}
+				return
+			}
+			batch = append(batch, data)
+			if w.eager && len(batch) >= w.maxBatch {
+				w.flush(batch)
+				batch = batch[:0]
+				ticker.Reset(w.interval)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush saves a batch in one transaction. The pages were counted as
+// successful when queued; if the transaction fails they are moved to the
+// failed count.
+func (w *pageWriter) flush(batch []parser.SEOData) {
+	c := w.crawler
+	err := c.store.Transaction(func(tx storage.Storage) error {
+		for _, data := range batch {
+			if err := c.savePage(tx, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	slog.Error("failed to save page batch", "pages", len(batch), "error", err)
+	n := int64(len(batch))
+	c.counts.success.Add(-n)
+	c.counts.completed.Add(-n)
+	c.counts.failed.Add(n)
+	for _, data := range batch {
+		if c.isThinContent(data) {
+			c.counts.thin.Add(-1)
+		}
+		if c.isLongRedirect(data.RedirectHops) {
+			c.counts.longRedirects.Add(-1)
+		}
+	}
+}
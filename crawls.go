@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CRAWLS
+// ============================================================================
+
+// printCrawls lists every crawl in the database, oldest first, with its
+// start URL and page count.
+func printCrawls(db *gorm.DB, w io.Writer) error {
+	var rows []struct {
+		ID         uint
+		RunID      string
+		StartedAt  time.Time
+		FinishedAt *time.Time
+		StartURL   string
+		Pages      int
+	}
+	err := db.Model(&storage.Crawl{}).
+		Select(`crawls.id, crawls.run_id, crawls.started_at, crawls.finished_at,
+			(SELECT MAX(start_url) FROM crawl_stats WHERE crawl_stats.run_id = crawls.run_id) AS start_url,
+			(SELECT COUNT(*) FROM pages WHERE pages.crawl_id = crawls.id) AS pages`).
+		Order("crawls.id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "no crawls")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"id", "run_id", "started_at", "finished_at", "pages", "start_url"}, "\t"))
+	for _, r := range rows {
+		finished := "-"
+		if r.FinishedAt != nil {
+			finished = r.FinishedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.RunID, r.StartedAt.Format(time.RFC3339), finished, r.Pages, r.StartURL)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// DUPLICATE TITLES AND META DESCRIPTIONS
+// ============================================================================
+
+// duplicatesReport rebuilds the duplicates first, so runs crawled before
+// the table existed are covered too.
+func duplicatesReport(db *gorm.DB, w io.Writer, runID string) error {
+	if err := storage.UpdateDuplicates(db, runID); err != nil {
+		return err
+	}
+
+	found := false
+	for _, field := range storage.DuplicateFields {
+		groups, err := storage.LoadDuplicates(db, runID, field)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		found = true
+		pages := 0
+		for _, g := range groups {
+			fmt.Fprintf(w, "%s shared by %d pages: %q\n", field, len(g.URLs), g.Value)
+			for _, u := range g.URLs {
+				fmt.Fprintf(w, "  %s\n", u)
+			}
+			pages += len(g.URLs)
+		}
+		fmt.Fprintf(w, "%d duplicate %s values on %d pages\n\n", len(groups), field, pages)
+	}
+	if !found {
+		fmt.Fprintln(w, "no duplicate titles or meta descriptions")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"crawl-guardian.com/crawler"
+	"crawl-guardian.com/parser"
+)
+
+// ============================================================================
+// EXPECTATIONS
+// ============================================================================
+
+// expectation is one entry of an -expect file. Zero values are not
+// checked, so an entry may assert only the status code. Redirects are
+// followed and the final response is checked.
+//
+//	[
+//	  {"url": "https://example.com/", "status": 200, "title": "Home"},
+//	  {"url": "https://example.com/gone", "status": 404},
+//	  {"url": "https://example.com/p?id=1", "canonical": "https://example.com/p"}
+//	]
+type expectation struct {
+	URL       string `json:"url"`
+	Status    int    `json:"status"`
+	Title     string `json:"title"`
+	Canonical string `json:"canonical"`
+}
+
+func loadExpectations(path string) ([]expectation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var expectations []expectation
+	if err := json.NewDecoder(f).Decode(&expectations); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i, e := range expectations {
+		if e.URL == "" {
+			return nil, fmt.Errorf("%s: entry %d has no url", path, i+1)
+		}
+	}
+	return expectations, nil
+}
+
+// checkExpectations fetches every URL in the expectations file through
+// the inspect path, prints one PASS/FAIL line per URL with the values that
+// differ, and returns the number of failed URLs.
+func checkExpectations(ctx context.Context, c *crawler.Crawler, path string, w io.Writer) (int, error) {
+	expectations, err := loadExpectations(path)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, e := range expectations {
+		var problems []string
+
+		data, err := c.Inspect(ctx, e.URL)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			problems = compareExpectation(e, data)
+		}
+
+		if len(problems) == 0 {
+			fmt.Fprintf(w, "PASS  %s\n", e.URL)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL  %s\n", e.URL)
+		for _, p := range problems {
+			fmt.Fprintf(w, "        %s\n", p)
+		}
+	}
+
+	fmt.Fprintf(w, "%d checked, %d passed, %d failed\n", len(expectations), len(expectations)-failed, failed)
+	return failed, nil
+}
+
+func compareExpectation(e expectation, data parser.SEOData) []string {
+	var problems []string
+	if e.Status != 0 && data.StatusCode != e.Status {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d", e.Status, data.StatusCode))
+	}
+	if e.Title != "" && strings.TrimSpace(data.Title) != strings.TrimSpace(e.Title) {
+		problems = append(problems, fmt.Sprintf("title: expected %q, got %q", e.Title, data.Title))
+	}
+	if e.Canonical != "" && !config.Normalizer().Same(data.Canonical, e.Canonical) {
+		problems = append(problems, fmt.Sprintf("canonical: expected %s, got %q", e.Canonical, data.Canonical))
+	}
+	return problems
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ============================================================================
+// EXPORT
+// ============================================================================
+
+// exportFormats are the values -export accepts.
+var exportFormats = []string{"csv", "jsonl"}
+
+// exportRun writes the pages of runID to path, or stdout when path is ""
+// or "-", one row or line per page with every column of the pages table.
+// With links and duplicates, the run's link edges and duplicate titles
+// and descriptions go to files next to path, named <name>-links.<ext>
+// and <name>-duplicates.<ext>.
+func exportRun(db *gorm.DB, runID, format, path string, links, duplicates bool) error {
+	n, err := exportTable(db, &storage.Page{}, runID, format, path)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d pages of run %s", n, runID)
+
+	ext := filepath.Ext(path)
+	extra := func(model any, name string) error {
+		extraPath := strings.TrimSuffix(path, ext) + "-" + name + ext
+		n, err := exportTable(db, model, runID, format, extraPath)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d %s to %s", n, name, extraPath)
+		return nil
+	}
+	if links {
+		if err := extra(&storage.Edge{}, "links"); err != nil {
+			return err
+		}
+	}
+	if duplicates {
+		if err := storage.UpdateDuplicates(db, runID); err != nil {
+			return err
+		}
+		if err := extra(&storage.Duplicate{}, "duplicates"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportTable streams the rows of model's table for runID to path,
+// ordered by ID, and returns how many it wrote.
+func exportTable(db *gorm.DB, model any, runID, format, path string) (int, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	fields := stmt.Schema.Fields
+
+	var out io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+
+	var write func(values []any) error
+	var flush func() error
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		header := make([]string, len(fields))
+		for i, field := range fields {
+			header[i] = field.DBName
+		}
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(fields))
+		write = func(values []any) error {
+			for i, v := range values {
+				record[i] = exportCSVValue(v)
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "jsonl":
+		write = func(values []any) error { return writeJSONLine(bw, fields, values) }
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("invalid export format %q (want %s)", format, strings.Join(exportFormats, ", "))
+	}
+
+	rows, err := db.Model(model).Scopes(storage.RunScope(runID)).Order("id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ctx := context.Background()
+	rowType := reflect.TypeOf(model).Elem()
+	values := make([]any, len(fields))
+	n := 0
+	for rows.Next() {
+		row := reflect.New(rowType)
+		if err := db.ScanRows(rows, row.Interface()); err != nil {
+			return n, err
+		}
+		for i, field := range fields {
+			values[i], _ = field.ValueOf(ctx, row.Elem())
+		}
+		if err := write(values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if err := flush(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// writeJSONLine writes one row as a JSON object keyed by column name, in
+// column order.
+func writeJSONLine(w *bufio.Writer, fields []*schema.Field, values []any) error {
+	w.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.DBName)
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", field.DBName, err)
+		}
+		w.Write(key)
+		w.WriteByte(':')
+		w.Write(value)
+	}
+	w.WriteString("}\n")
+	return nil
+}
+
+// exportCSVValue formats a column value for CSV: times as RFC 3339, and
+// unset optional values as empty cells.
+func exportCSVValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,132 @@
+package fetch
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// ============================================================================
+// BODY SIZE ACCOUNTING
+// ============================================================================
+
+// ErrByteBudget is returned for requests once -byte-budget bytes have
+// been downloaded.
+var ErrByteBudget = errors.New("byte budget exhausted")
+
+// checkByteBudget fails once -byte-budget bytes have been downloaded.
+func (c *Client) checkByteBudget() error {
+	if c.config.ByteBudget > 0 && c.bytesDownloaded.Load() >= c.config.ByteBudget {
+		return ErrByteBudget
+	}
+	return nil
+}
+
+// TooLarge reports whether a response announces a Content-Length above
+// -skip-larger-than, so it can be skipped before its body is read.
+// Responses without a Content-Length are never skipped here; -max-body-bytes
+// bounds those.
+func (c *Client) TooLarge(resp *http.Response) bool {
+	return c.config.SkipLargerThan > 0 && resp.ContentLength > c.config.SkipLargerThan
+}
+
+// countingBody wraps a response body and counts the bytes read through
+// it. Content-Length is never trusted: chunked responses and servers that
+// lie about the length are accounted for just the same. With a limit, the
+// body ends after limit bytes and Truncated reports whether more data was
+// left unread. Every byte read is also added to total.
+type countingBody struct {
+	rc        io.ReadCloser
+	url       string
+	limit     int64
+	total     *atomic.Int64
+	n         int64
+	probed    bool
+	truncated bool
+}
+
+func newCountingBody(rc io.ReadCloser, url string, limit int64, total *atomic.Int64) *countingBody {
+	return &countingBody{rc: rc, url: url, limit: limit, total: total}
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	if b.limit > 0 {
+		if b.n >= b.limit {
+			b.probe()
+			return 0, io.EOF
+		}
+		if remaining := b.limit - b.n; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err := b.rc.Read(p)
+	b.n += int64(n)
+	b.total.Add(int64(n))
+	return n, err
+}
+
+// probe checks once whether the body continues past the limit.
+func (b *countingBody) probe() {
+	if b.probed {
+		return
+	}
+	b.probed = true
+
+	var extra [1]byte
+	if n, _ := io.ReadFull(b.rc, extra[:]); n > 0 {
+		b.total.Add(int64(n))
+		b.truncated = true
+		slog.Warn("response body truncated", "url", b.url, "limit", b.limit)
+	}
+}
+
+func (b *countingBody) Close() error {
+	return b.rc.Close()
+}
+
+// BytesRead returns the number of body bytes delivered to the reader.
+func (b *countingBody) BytesRead() int64 {
+	return b.n
+}
+
+func (b *countingBody) Truncated() bool {
+	return b.truncated
+}
+
+// Truncated reports whether body was cut off at -max-body-bytes. It
+// must be called once the body has been read to the end.
+func Truncated(body io.ReadCloser) bool {
+	b, ok := body.(*countingBody)
+	return ok && b.Truncated()
+}
+
+// ============================================================================
+// CONTENT TYPES
+// ============================================================================
+
+// ContentType returns the media type of a response, lowercased
+// and without parameters. Without a usable Content-Type header it is
+// sniffed from body, following the WHATWG algorithm of
+// http.DetectContentType; pass a nil body to skip sniffing.
+func ContentType(resp *http.Response, body []byte) string {
+	if header := resp.Header.Get("Content-Type"); header != "" {
+		if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+			return mediaType
+		}
+	}
+	if body == nil {
+		return ""
+	}
+	mediaType, _, _ := strings.Cut(http.DetectContentType(body), ";")
+	return mediaType
+}
+
+// IsHTML reports whether a media type is parsed as HTML.
+func IsHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
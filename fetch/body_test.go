@@ -0,0 +1,81 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkedServer writes body in chunks of 100 bytes, flushing after each,
+// so the response has no Content-Length.
+func chunkedServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		for rest := body; rest != ""; {
+			n := min(100, len(rest))
+			io.WriteString(w, rest[:n])
+			w.(http.Flusher).Flush()
+			rest = rest[n:]
+		}
+	}))
+}
+
+func TestChunkedBodyCounted(t *testing.T) {
+	body := "<html><body>" + strings.Repeat("chunked ", 1000) + "</body></html>"
+	tests := []struct {
+		limit         int64
+		wantRead      int64
+		wantCounted   int64
+		wantTruncated bool
+	}{
+		{limit: 0, wantRead: int64(len(body)), wantCounted: int64(len(body))},
+		{limit: int64(len(body)), wantRead: int64(len(body)), wantCounted: int64(len(body))},
+		// The byte read to find the body continues is counted too.
+		{limit: 1000, wantRead: 1000, wantCounted: 1001, wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("limit=", tt.limit), func(t *testing.T) {
+			srv := chunkedServer(body)
+			defer srv.Close()
+
+			c, err := New(context.Background(), Config{
+				ClientProfile:  "go",
+				RequestTimeout: 5 * time.Second,
+				MaxAttempts:    1,
+				MaxBodyBytes:   tt.limit,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			resp, err := c.Get(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ContentLength != -1 {
+				t.Errorf("ContentLength = %d, want -1 for a chunked response", resp.ContentLength)
+			}
+			read, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if int64(len(read)) != tt.wantRead {
+				t.Errorf("read %d bytes, want %d", len(read), tt.wantRead)
+			}
+			if got := c.BytesDownloaded(); got != tt.wantCounted {
+				t.Errorf("BytesDownloaded() = %d, want %d", got, tt.wantCounted)
+			}
+			if got := Truncated(resp.Body); got != tt.wantTruncated {
+				t.Errorf("Truncated() = %v, want %v", got, tt.wantTruncated)
+			}
+		})
+	}
+}
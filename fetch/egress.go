@@ -0,0 +1,110 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// EGRESS
+// ============================================================================
+
+// egressInfo records how a request left this machine: the local address
+// of the connection and, with -proxies, the proxy it went through.
+type egressInfo struct {
+	mu      sync.Mutex
+	localIP string
+	proxy   string
+}
+
+type egressInfoKey struct{}
+
+// withEgressInfo returns a context that records the egress of requests
+// made with it.
+func withEgressInfo(ctx context.Context) context.Context {
+	info := &egressInfo{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(conn httptrace.GotConnInfo) {
+			if conn.Conn == nil {
+				return
+			}
+			host, _, err := net.SplitHostPort(conn.Conn.LocalAddr().String())
+			if err != nil {
+				return
+			}
+			info.mu.Lock()
+			defer info.mu.Unlock()
+			info.localIP = host
+		},
+	}
+	ctx = context.WithValue(ctx, egressInfoKey{}, info)
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+func egressInfoFrom(ctx context.Context) *egressInfo {
+	info, _ := ctx.Value(egressInfoKey{}).(*egressInfo)
+	return info
+}
+
+func (e *egressInfo) setProxy(proxy string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.proxy = proxy
+}
+
+// Egress returns the local IP the request for req left from and, with
+// -proxies, the proxy it went through. Both are empty unless
+// -record-egress is set.
+func Egress(req *http.Request) (localIP, proxy string) {
+	if req == nil {
+		return "", ""
+	}
+	e := egressInfoFrom(req.Context())
+	if e == nil {
+		return "", ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.localIP, e.proxy
+}
+
+// LookupEgressIP asks an IP echo service, which answers with the caller's
+// address as plain text, for the public IP requests leave from. It goes
+// through the crawl's transport, so with -proxies it reports the IP of
+// whichever proxy served the lookup.
+func (c *Client) LookupEgressIP(ctx context.Context, echoURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", echoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", c.UserAgent())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: status %d", echoURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 100))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s: unexpected answer %q", echoURL, ip)
+	}
+	return ip, nil
+}
@@ -0,0 +1,447 @@
+// Package fetch makes the requests of a crawl. A Client puts every page,
+// sitemap and API request through robots.txt, the per-host limits and
+// budget, retries, proxies, the cookie jar and login session, request
+// signing and, with rendering on, headless Chrome.
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// CONFIGURATION
+// ============================================================================
+
+// Config holds the request settings of a crawl. Each field is set by the
+// command-line flag of the same name, see the crawler package.
+type Config struct {
+	UserAgent  string
+	Headers    [][2]string
+	CookieFile string
+	// LoginURL is the login form to sign in through before crawling,
+	// filled with LoginFields ("name=value"). LoginExpired matches pages
+	// that show the session has run out.
+	LoginURL     string
+	LoginFields  []string
+	LoginExpired string
+	Robots       bool
+	RobotsUA     string
+
+	ClientProfile       string
+	RequestTimeout      time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	HTTP2               bool
+	MaxRedirects        int
+
+	MaxBodyBytes   int64
+	SkipLargerThan int64
+	ByteBudget     int64
+
+	WarmupDelay time.Duration
+
+	MaxAttempts     int
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	MaxCooldown     time.Duration
+	HostDelay       time.Duration
+	HostBurst       int
+	HostConcurrency int
+
+	TraceTimings bool
+
+	// Headless rendering
+	Render            bool
+	RenderPatterns    []string
+	RenderChrome      string
+	RenderWait        time.Duration
+	RenderTimeout     time.Duration
+	RenderConcurrency int
+
+	RecordEgress  bool
+	EgressEchoURL string
+
+	HMACKey             string
+	HMACHeader          string
+	HMACTimestampHeader string
+
+	Proxies            []string
+	ProxyFile          string
+	ProxyRotation      string
+	ProxyFailThreshold int
+	ProxyRetest        time.Duration
+}
+
+// ============================================================================
+// CLIENT
+// ============================================================================
+
+// Client makes the requests of one crawl. Its helpers are set up by New
+// from the config, the ones not enabled left nil, and it is safe for use
+// by every worker and discovery goroutine at once.
+type Client struct {
+	config Config
+
+	http      *http.Client
+	transport http.RoundTripper
+
+	signer       RequestInterceptor // -hmac-key
+	interceptors []RequestInterceptor
+	robots       *robotsCache // unless -robots=false
+	warmup       *hostWarmup  // -warmup-delay
+	limiter      *hostLimiter
+	hostSlots    *hostSlotPool // -host-concurrency
+	proxies      *proxyPool    // -proxies, -proxy-file
+	login        *loginSession // -login-url
+	render       *renderer     // -render, -render-pattern
+	budget       Budget        // -host-budget
+	validators   func(*http.Request)
+
+	// wrapTransport wraps or replaces the transport, see WithTransport.
+	wrapTransport func(base http.RoundTripper) http.RoundTripper
+
+	// bytesDownloaded counts response body bytes actually read.
+	bytesDownloaded atomic.Int64
+	// renderedPages counts pages whose body came from Chrome.
+	renderedPages atomic.Int64
+}
+
+// Budget caps the requests sent to each host, see -host-budget. Wait
+// takes one request from rawURL's host, blocking while it is spent.
+type Budget interface {
+	Wait(ctx context.Context, rawURL string) error
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBudget counts every request against b.
+func WithBudget(b Budget) Option {
+	return func(c *Client) { c.budget = b }
+}
+
+// WithInterceptors runs interceptors, in order, on every page, sitemap
+// and API request, see RequestInterceptor.
+func WithInterceptors(interceptors ...RequestInterceptor) Option {
+	return func(c *Client) { c.interceptors = append(c.interceptors, interceptors...) }
+}
+
+// WithTransport wraps or replaces the transport every request is sent
+// through: the direct transport, or the -proxies pool when there is one.
+func WithTransport(wrap func(base http.RoundTripper) http.RoundTripper) Option {
+	return func(c *Client) { c.wrapTransport = wrap }
+}
+
+// WithValidators calls apply on every page request before it is sent, to
+// add the If-None-Match and If-Modified-Since headers of -revalidate.
+func WithValidators(apply func(*http.Request)) Option {
+	return func(c *Client) { c.validators = apply }
+}
+
+// New sets up a client for cfg. With -login-url it signs in before
+// returning, so the crawl starts with a session.
+func New(ctx context.Context, cfg Config, opts ...Option) (*Client, error) {
+	if err := CheckClientProfile(cfg.ClientProfile); err != nil {
+		return nil, err
+	}
+
+	c := &Client{config: cfg}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if cfg.HMACKey != "" {
+		c.signer = hmacSigner([]byte(cfg.HMACKey), cfg.HMACHeader, cfg.HMACTimestampHeader)
+	}
+
+	proxyURLs := cfg.Proxies
+	if cfg.ProxyFile != "" {
+		urls, err := loadProxyFile(cfg.ProxyFile)
+		if err != nil {
+			return nil, err
+		}
+		proxyURLs = append(proxyURLs[:len(proxyURLs):len(proxyURLs)], urls...)
+	}
+	if len(proxyURLs) > 0 {
+		pool, err := newProxyPool(proxyURLs, cfg.ProxyFailThreshold, cfg.ProxyRetest, cfg.ProxyRotation, c.baseTransport)
+		if err != nil {
+			return nil, err
+		}
+		c.proxies = pool
+	}
+
+	// Without -cookies or -login-url there is no jar, so every page is
+	// seen as a first visit.
+	var jar http.CookieJar
+	if cfg.CookieFile != "" || cfg.LoginURL != "" {
+		j, err := newCookieJar()
+		if err != nil {
+			return nil, err
+		}
+		jar = j
+	}
+	if cfg.CookieFile != "" {
+		n, err := loadCookieFile(jar, cfg.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d cookies from %s", n, cfg.CookieFile)
+	}
+	c.buildClient(jar)
+
+	if cfg.Robots {
+		c.robots = newRobotsCache(c, cfg.RobotsUA)
+	}
+	if cfg.WarmupDelay > 0 {
+		c.warmup = newHostWarmup(c, cfg.WarmupDelay)
+	}
+	c.limiter = newHostLimiter(c.robots, cfg.HostDelay, cfg.HostBurst)
+	if cfg.HostConcurrency > 0 {
+		c.hostSlots = newHostSlotPool(cfg.HostConcurrency)
+	}
+	if cfg.Render || len(cfg.RenderPatterns) > 0 {
+		r, err := newRenderer(c, cfg.Render, cfg.RenderPatterns, cfg.RenderChrome,
+			cfg.RenderWait, cfg.RenderTimeout, cfg.RenderConcurrency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up rendering: %w", err)
+		}
+		c.render = r
+	}
+	if cfg.LoginURL != "" {
+		l, err := newLoginSession(c, cfg.LoginURL, cfg.LoginFields, cfg.LoginExpired)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := l.SignIn(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.login = l
+	}
+	return c, nil
+}
+
+// Close stops Chrome, when rendering, and closes idle connections.
+func (c *Client) Close() {
+	if c.render != nil {
+		c.render.Close()
+	}
+	c.http.CloseIdleConnections()
+}
+
+// Rendering reports whether some pages are rendered with headless Chrome.
+func (c *Client) Rendering() bool {
+	return c.render != nil
+}
+
+// RenderedPages returns the number of pages whose body came from Chrome.
+func (c *Client) RenderedPages() int64 {
+	return c.renderedPages.Load()
+}
+
+// BytesDownloaded returns the number of response body bytes read so far.
+func (c *Client) BytesDownloaded() int64 {
+	return c.bytesDownloaded.Load()
+}
+
+// Allowed reports whether robots.txt lets the crawler fetch rawURL. Every
+// URL is allowed with -robots=false.
+func (c *Client) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	if c.robots == nil {
+		return true, nil
+	}
+	return c.robots.Allowed(ctx, rawURL)
+}
+
+// HostBusy reports whether every -host-concurrency slot of rawURL's host
+// is taken.
+func (c *Client) HostBusy(rawURL string) bool {
+	return c.hostSlots != nil && c.hostSlots.Busy(rawURL)
+}
+
+// ============================================================================
+// HTTP REQUEST
+// ============================================================================
+
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+}
+
+func randomUserAgent() string {
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// UserAgent is the User-Agent header sent with requests: -user-agent
+// when set, otherwise one of userAgents at random. It is never used for
+// robots.txt matching, see -robots-ua.
+func (c *Client) UserAgent() string {
+	if c.config.UserAgent != "" {
+		return c.config.UserAgent
+	}
+	return randomUserAgent()
+}
+
+// Get fetches url with a GET, retrying transient failures (see
+// retryable). The last attempt's response or error is returned.
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	return c.Do(ctx, url, c.newPageRequest)
+}
+
+// NewRequestFunc builds the request of one attempt at url. Headers,
+// interceptors and the cookie jar are applied when it is sent.
+type NewRequestFunc func(ctx context.Context, url string) (*http.Request, error)
+
+// Do sends the requests newRequest builds for url, subject to robots.txt
+// and the host's limits, retrying transient failures.
+func (c *Client) Do(ctx context.Context, url string, newRequest NewRequestFunc) (*http.Response, error) {
+	if c.robots != nil {
+		if allowed, err := c.robots.Allowed(ctx, url); err != nil {
+			return nil, err
+		} else if !allowed {
+			return nil, ErrDisallowed
+		}
+	}
+
+	// counted leaves out the attempts that ended in a cooldown.
+	counted, cooldowns := 0, 0
+	for attempt := 1; ; attempt++ {
+		resp, err := c.requestOnce(withAttempt(ctx, attempt), url, newRequest)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		// Wait out the host's cooldown; the next request is held back by
+		// the limiter until then.
+		if pause, ok := cooldown(resp); ok && pause <= c.config.MaxCooldown && cooldowns < maxCooldowns {
+			cooldowns++
+			slog.Warn("host cooling down", "url", url, "status", resp.StatusCode, "retry_after", pause)
+			c.limiter.Pause(url, time.Now().Add(pause))
+			resp.Body.Close()
+			continue
+		}
+
+		counted++
+		if counted >= c.config.MaxAttempts || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := c.retryDelay(counted)
+		if err == nil {
+			slog.Warn("retrying request", "url", url, "attempt", attempt, "status", resp.StatusCode, "delay", delay)
+			resp.Body.Close()
+		} else {
+			slog.Warn("retrying request", "url", url, "attempt", attempt, "error", err, "delay", delay)
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// requestOnce makes a single attempt at fetching url, once the host's
+// limits allow it.
+func (c *Client) requestOnce(ctx context.Context, url string, newRequest NewRequestFunc) (*http.Response, error) {
+	if c.budget != nil {
+		if err := c.budget.Wait(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.checkByteBudget(); err != nil {
+		return nil, err
+	}
+	if c.warmup != nil {
+		if err := c.warmup.Wait(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	// The slot is taken before the token, so a request waiting for a slot
+	// can't go out right after the one before it.
+	release := func() {}
+	if c.hostSlots != nil {
+		r, err := c.hostSlots.Acquire(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		release = r
+	}
+	if err := c.limiter.Wait(ctx, url); err != nil {
+		release()
+		return nil, err
+	}
+
+	ctx = withPhaseTimings(ctx)
+	if c.config.RecordEgress {
+		ctx = withEgressInfo(ctx)
+	}
+	rendered := c.render != nil && c.render.Applies(url)
+	if rendered {
+		ctx = withRenderMark(ctx)
+	}
+	var generation int
+	if c.login != nil {
+		generation = c.login.Generation()
+	}
+	resp, err := c.sendRequest(ctx, url, newRequest)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if c.login != nil && c.login.Expired(url, resp) {
+		resp.Body.Close()
+		if err := c.login.Renew(ctx, generation); err != nil {
+			release()
+			return nil, fmt.Errorf("session expired: %w", err)
+		}
+		if resp, err = c.sendRequest(ctx, url, newRequest); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	if rendered {
+		c.render.Render(ctx, resp)
+	}
+	resp.Body = newCountingBody(&slotBody{resp.Body, release}, url, c.config.MaxBodyBytes, &c.bytesDownloaded)
+
+	return resp, nil
+}
+
+// newPageRequest builds the GET request for a page.
+func (c *Client) newPageRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent())
+	req = c.applyClientProfile(req)
+	if c.validators != nil {
+		c.validators(req)
+	}
+	return req, nil
+}
+
+// sendRequest builds a request with newRequest and sends it.
+func (c *Client) sendRequest(ctx context.Context, url string, newRequest NewRequestFunc) (*http.Response, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.interceptRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
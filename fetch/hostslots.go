@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+)
+
+// ============================================================================
+// PER-HOST CONCURRENCY
+// ============================================================================
+
+// hostSlotPool caps the requests in flight to each host at -host-concurrency,
+// however many workers and discovery goroutines there are. A request
+// holds its host's slot from before it is sent until its body has been
+// read to the end or closed, so a slow host can't take up the whole
+// crawl while other hosts are waiting.
+type hostSlotPool struct {
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostSlotPool(limit int) *hostSlotPool {
+	return &hostSlotPool{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+func (p *hostSlotPool) slotsFor(host string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.slots[host]
+	if !ok {
+		slots = make(chan struct{}, p.limit)
+		p.slots[host] = slots
+	}
+	return slots
+}
+
+// Acquire blocks until a request to rawURL's host may be in flight, and
+// returns the function that gives the slot back.
+func (p *hostSlotPool) Acquire(ctx context.Context, rawURL string) (func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return func() {}, nil
+	}
+	slots := p.slotsFor(u.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
+
+// Busy reports whether every slot of rawURL's host is taken.
+func (p *hostSlotPool) Busy(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	slots := p.slotsFor(u.Host)
+	return len(slots) == cap(slots)
+}
+
+// slotBody gives its request's host slot back once the body has been
+// read to the end or closed, whichever comes first.
+type slotBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *slotBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *slotBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ============================================================================
+// REQUEST INTERCEPTORS
+// ============================================================================
+
+// A RequestInterceptor may modify a request right before it is sent, after
+// the User-Agent, client profile and -header headers are set. Returning an error
+// aborts the request. Interceptors passed to WithInterceptors are the
+// extension point for request signing, auth tokens or other per-request
+// changes.
+type RequestInterceptor func(req *http.Request) error
+
+// interceptRequest sets the -header headers on req and runs the
+// interceptors, then the built-in HMAC signer of -hmac-key.
+func (c *Client) interceptRequest(req *http.Request) error {
+	c.applyHeaders(req)
+	interceptors := c.interceptors
+	if c.signer != nil {
+		interceptors = append(interceptors[:len(interceptors):len(interceptors)], c.signer)
+	}
+	for _, intercept := range interceptors {
+		if err := intercept(req); err != nil {
+			return fmt.Errorf("request interceptor: %w", err)
+		}
+	}
+	return nil
+}
+
+// hmacSigner signs each request with HMAC-SHA256 over
+//
+//	METHOD "\n" path?query "\n" unix-timestamp
+//
+// keyed with key. The timestamp goes into timestampHeader and the
+// hex-encoded signature into signatureHeader.
+func hmacSigner(key []byte, signatureHeader, timestampHeader string) RequestInterceptor {
+	return func(req *http.Request) error {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		mac := hmac.New(sha256.New, key)
+		fmt.Fprintf(mac, "%s\n%s\n%s", req.Method, req.URL.RequestURI(), ts)
+
+		req.Header.Set(timestampHeader, ts)
+		req.Header.Set(signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
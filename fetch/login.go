@@ -0,0 +1,297 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// LOGIN
+// ============================================================================
+
+// loginSession signs in through a login form before the crawl, leaving
+// the session cookies in the shared cookie jar, and signs in again when a
+// page shows the session has expired: the request ends up on the login
+// page, or its body matches -login-expired. The page is then fetched once
+// more with the new session.
+type loginSession struct {
+	client   *Client
+	loginURL *url.URL
+	fields   url.Values     // -login-field values, filled into the form
+	expired  *regexp.Regexp // -login-expired; nil checks redirects only
+
+	mu         sync.Mutex
+	generation int // sign-ins so far
+}
+
+// errLoginFailed is returned when the login form is still shown after
+// submitting it.
+var errLoginFailed = errors.New("login failed: still on the login page")
+
+func newLoginSession(client *Client, rawURL string, fields []string, expiredPattern string) (*loginSession, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("invalid login url %q", rawURL)
+	}
+	l := &loginSession{client: client, loginURL: u, fields: url.Values{}}
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid login field %q (want name=value)", field)
+		}
+		// Values may come from the environment, keeping passwords out of
+		// the command line: -login-field 'password=$SITE_PASSWORD'.
+		l.fields.Set(name, os.ExpandEnv(value))
+	}
+	if expiredPattern != "" {
+		if l.expired, err = regexp.Compile(expiredPattern); err != nil {
+			return nil, fmt.Errorf("invalid -login-expired: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Generation returns the number of sign-ins so far, to be passed to
+// Renew by requests made with the current session.
+func (l *loginSession) Generation() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.generation
+}
+
+// Renew signs in again, unless another request already did since
+// generation was read.
+func (l *loginSession) Renew(ctx context.Context, generation int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.generation != generation {
+		return nil
+	}
+	slog.Warn("session expired, signing in again", "login_url", l.loginURL.String())
+	return l.signIn(ctx)
+}
+
+// SignIn signs in for the first time.
+func (l *loginSession) SignIn(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.signIn(ctx)
+}
+
+// signIn fetches the login page, fills the configured fields into its
+// form, keeping hidden inputs such as CSRF tokens, and submits it. l.mu
+// must be held.
+func (l *loginSession) signIn(ctx context.Context) error {
+	page, err := l.fetch(ctx, http.MethodGet, l.loginURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch login page: %w", err)
+	}
+	action, method, values, err := loginForm(page.body, page.url)
+	if err != nil {
+		return err
+	}
+	for name, v := range l.fields {
+		values[name] = v
+	}
+
+	var result *fetchedPage
+	if method == http.MethodGet {
+		action.RawQuery = values.Encode()
+		result, err = l.fetch(ctx, method, action.String(), nil)
+	} else {
+		result, err = l.fetch(ctx, method, action.String(), values)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to submit login form: %w", err)
+	}
+	if result.status >= 400 {
+		return fmt.Errorf("login failed: status %d", result.status)
+	}
+	if l.onLoginPage(result.url) {
+		if _, _, _, err := loginForm(result.body, result.url); err == nil {
+			return errLoginFailed
+		}
+	}
+
+	l.generation++
+	slog.Info("signed in", "login_url", l.loginURL.String(), "landed_on", result.url.String())
+	return nil
+}
+
+type fetchedPage struct {
+	url    *url.URL // after redirects
+	status int
+	body   []byte
+}
+
+// fetch makes one login request through the crawl's client, so the
+// cookies land in the crawl's jar. Form values are posted urlencoded.
+func (l *loginSession) fetch(ctx context.Context, method, target string, form url.Values) (*fetchedPage, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", l.client.UserAgent())
+	req = l.client.applyClientProfile(req)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if err := l.client.interceptRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := l.client.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max(l.client.config.MaxBodyBytes, 0)+1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return &fetchedPage{url: resp.Request.URL, status: resp.StatusCode, body: data}, nil
+}
+
+// onLoginPage reports whether u is the login page.
+func (l *loginSession) onLoginPage(u *url.URL) bool {
+	return strings.EqualFold(u.Host, l.loginURL.Host) && u.Path == l.loginURL.Path
+}
+
+// Expired reports whether resp, for a request to requestURL, shows the
+// session has run out. With -login-expired the body is read to check
+// it, and put back buffered.
+func (l *loginSession) Expired(requestURL string, resp *http.Response) bool {
+	if u, err := url.Parse(requestURL); err == nil && l.onLoginPage(u) {
+		return false
+	}
+	if l.onLoginPage(resp.Request.URL) {
+		return true
+	}
+	if l.expired == nil || !IsHTML(ContentType(resp, nil)) {
+		return false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && l.expired.Match(body)
+}
+
+// loginForm finds the form to sign in with on a login page: the first
+// form with a password field, or else the first form. It returns where
+// and how to submit it, and the values of its prefilled inputs.
+func loginForm(body []byte, base *url.URL) (*url.URL, string, url.Values, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var forms []*html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "form" {
+			forms = append(forms, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	if len(forms) == 0 {
+		return nil, "", nil, errors.New("no form found on the login page")
+	}
+
+	form := forms[0]
+	for _, f := range forms {
+		if hasPasswordInput(f) {
+			form = f
+			break
+		}
+	}
+
+	action, err := base.Parse(strings.TrimSpace(getAttr(form, "action")))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("invalid login form action: %w", err)
+	}
+	method := http.MethodPost
+	if strings.EqualFold(getAttr(form, "method"), http.MethodGet) {
+		method = http.MethodGet
+	}
+
+	values := url.Values{}
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			name := getAttr(n, "name")
+			switch strings.ToLower(getAttr(n, "type")) {
+			case "submit", "button", "image", "reset", "file":
+			case "checkbox", "radio":
+				if _, checked := attrValue(n, "checked"); checked && name != "" {
+					values.Add(name, valueOr(n, "on"))
+				}
+			default:
+				if name != "" {
+					values.Add(name, getAttr(n, "value"))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(form)
+	return action, method, values, nil
+}
+
+func hasPasswordInput(n *html.Node) bool {
+	if n.Type == html.ElementNode && n.Data == "input" && strings.EqualFold(getAttr(n, "type"), "password") {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if hasPasswordInput(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue returns an attribute's value and whether it is present.
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// getAttr returns an attribute's value, empty when it is missing.
+func getAttr(n *html.Node, key string) string {
+	v, _ := attrValue(n, key)
+	return v
+}
+
+// valueOr returns the value attribute of n, or def when it has none.
+func valueOr(n *html.Node, def string) string {
+	if v, ok := attrValue(n, "value"); ok {
+		return v
+	}
+	return def
+}
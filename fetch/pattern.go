@@ -0,0 +1,40 @@
+package fetch
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ============================================================================
+// URL PATTERNS
+// ============================================================================
+
+// URLPattern is an -include, -exclude or -render-pattern pattern. Regexps
+// match anywhere in the full URL. Patterns starting with "glob:" use
+// robots.txt syntax instead and match the start of the path and query:
+// * stands for any run of characters and a trailing $ anchors the end.
+type URLPattern struct {
+	glob bool
+	re   *regexp.Regexp
+}
+
+// CompileURLPattern parses a URLPattern.
+func CompileURLPattern(pattern string) (URLPattern, error) {
+	if glob, ok := strings.CutPrefix(pattern, "glob:"); ok {
+		return URLPattern{glob: true, re: compileRobotsPattern(glob)}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return URLPattern{}, err
+	}
+	return URLPattern{re: re}, nil
+}
+
+// Match reports whether u matches the pattern.
+func (p URLPattern) Match(u *url.URL) bool {
+	if p.glob {
+		return p.re.MatchString(u.RequestURI())
+	}
+	return p.re.MatchString(u.String())
+}
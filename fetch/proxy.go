@@ -0,0 +1,220 @@
+package fetch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PROXY POOL
+// ============================================================================
+
+// A proxyPool rotates requests round-robin through a list of proxies.
+// A proxy that fails -proxy-fail-threshold requests in a row with a
+// connection error is taken out of rotation; after -proxy-retest it gets
+// one trial request, which either brings it back or benches it again. A
+// request that fails on a proxy is retried through the next one, so a
+// dying proxy costs time rather than pages.
+//
+// With -proxy-rotation sticky, each host keeps the proxy it was first
+// sent through for as long as that proxy stays in rotation, so sites
+// that tie sessions to an IP see a stable one.
+type proxyPool struct {
+	threshold int
+	retest    time.Duration
+	sticky    bool
+
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+	byHost  map[string]*proxyState // sticky assignments
+}
+
+// -proxy-rotation modes.
+const (
+	ProxyRoundRobin = "round-robin"
+	ProxySticky     = "sticky"
+)
+
+// ProxyRotations lists the -proxy-rotation modes.
+var ProxyRotations = []string{ProxyRoundRobin, ProxySticky}
+
+type proxyState struct {
+	url       *url.URL
+	transport http.RoundTripper
+
+	failures  int
+	downUntil time.Time // zero while in rotation
+	testing   bool      // a trial request is in flight
+}
+
+// newProxyPool sets up a pool sending requests through rawURLs, each
+// with its own transport from newTransport.
+func newProxyPool(rawURLs []string, threshold int, retest time.Duration, rotation string, newTransport func() *http.Transport) (*proxyPool, error) {
+	p := &proxyPool{
+		threshold: max(threshold, 1),
+		retest:    retest,
+		sticky:    rotation == ProxySticky,
+		byHost:    make(map[string]*proxyState),
+	}
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", raw)
+		}
+
+		t := newTransport()
+		t.Proxy = http.ProxyURL(u)
+		p.proxies = append(p.proxies, &proxyState{url: u, transport: t})
+	}
+	if len(p.proxies) == 0 {
+		return nil, errors.New("no proxies given")
+	}
+	return p, nil
+}
+
+// loadProxyFile reads proxy URLs from a file, one per line. Blank lines
+// and lines starting with # are skipped.
+func loadProxyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open proxy file: %w", err)
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read proxy file: %w", err)
+	}
+	return urls, nil
+}
+
+// pick returns the proxy for a request to host: with sticky rotation the
+// host's own proxy while it is in rotation, otherwise the next proxy in
+// rotation that hasn't been tried for this request. A benched proxy due
+// for a re-test is handed out as a trial; when every proxy is benched,
+// the one due back first is used anyway.
+func (p *proxyPool) pick(host string, tried map[*proxyState]bool) *proxyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s := p.byHost[host]; p.sticky && s != nil && !tried[s] && s.downUntil.IsZero() {
+		return s
+	}
+
+	now := time.Now()
+	var fallback *proxyState
+	for i := 0; i < len(p.proxies); i++ {
+		s := p.proxies[(p.next+i)%len(p.proxies)]
+		if tried[s] {
+			continue
+		}
+		switch {
+		case s.downUntil.IsZero():
+		case !s.testing && !now.Before(s.downUntil):
+			s.testing = true
+		default:
+			if fallback == nil || s.downUntil.Before(fallback.downUntil) {
+				fallback = s
+			}
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.proxies)
+		if p.sticky {
+			p.byHost[host] = s
+		}
+		return s
+	}
+	return fallback
+}
+
+func (p *proxyPool) report(s *proxyState, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wasTesting := s.testing
+	s.testing = false
+	if err == nil {
+		if !s.downUntil.IsZero() {
+			slog.Info("proxy back in rotation", "proxy", s.url.Host)
+		}
+		s.failures = 0
+		s.downUntil = time.Time{}
+		return
+	}
+
+	s.failures++
+	if wasTesting || s.failures >= p.threshold {
+		s.downUntil = time.Now().Add(p.retest)
+		slog.Warn("proxy taken out of rotation", "proxy", s.url.Host,
+			"failures", s.failures, "retest_in", p.retest, "error", err)
+	}
+}
+
+// RoundTrip sends req through a proxy, moving on to the next proxy after
+// a connection error until every proxy has been tried once. Requests with
+// a body that can't be replayed are not retried.
+func (p *proxyPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried := make(map[*proxyState]bool)
+	var lastErr error
+	for {
+		s := p.pick(req.URL.Host, tried)
+		if s == nil {
+			return nil, lastErr
+		}
+		tried[s] = true
+
+		attempt := req
+		if len(tried) > 1 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, lastErr
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+
+		if info := egressInfoFrom(req.Context()); info != nil {
+			info.setProxy(s.url.Host)
+		}
+		resp, err := s.transport.RoundTrip(attempt)
+		if err != nil && req.Context().Err() != nil {
+			// Canceled or timed out by the caller, not the proxy's fault.
+			return nil, err
+		}
+		p.report(s, err)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = fmt.Errorf("proxy %s: %w", s.url.Host, err)
+	}
+}
+
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach the
+// per-proxy transports.
+func (p *proxyPool) CloseIdleConnections() {
+	for _, s := range p.proxies {
+		if t, ok := s.transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package fetch
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PER-HOST RATE LIMITING
+// ============================================================================
+
+// hostLimiter spaces requests to each host with a token bucket shared by
+// every worker and discovery goroutine. A host gets one token per -host-delay,
+// up to -host-burst; a robots.txt Crawl-delay replaces the delay for its
+// host, with no burst.
+//
+// A host that answers 429 or 503 with Retry-After is paused: no request
+// goes to it until the cooldown is over.
+type hostLimiter struct {
+	mu      sync.Mutex
+	robots  *robotsCache // nil with -robots=false
+	delay   time.Duration
+	burst   int
+	buckets map[string]*tokenBucket
+	paused  map[string]time.Time // host -> end of its cooldown
+}
+
+type tokenBucket struct {
+	tokens float64 // negative when callers are waiting for future tokens
+	last   time.Time
+}
+
+func newHostLimiter(robots *robotsCache, delay time.Duration, burst int) *hostLimiter {
+	return &hostLimiter{
+		robots:  robots,
+		delay:   delay,
+		burst:   max(burst, 1),
+		buckets: make(map[string]*tokenBucket),
+		paused:  make(map[string]time.Time),
+	}
+}
+
+// Pause holds back every request to rawURL's host until until.
+func (l *hostLimiter) Pause(rawURL string, until time.Time) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.paused[u.Host]) {
+		l.paused[u.Host] = until
+	}
+}
+
+func (l *hostLimiter) pausedFor(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.paused[host])
+}
+
+// Wait blocks until a request to rawURL's host may start, reserving a
+// token for the caller.
+func (l *hostLimiter) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	if err := sleepContext(ctx, l.pausedFor(u.Host)); err != nil {
+		return err
+	}
+
+	interval, burst := l.delay, l.burst
+	if l.robots != nil {
+		crawlDelay, err := l.robots.CrawlDelay(ctx, u)
+		if err != nil {
+			return err
+		}
+		if crawlDelay > 0 {
+			interval, burst = crawlDelay, 1
+		}
+	}
+	if interval <= 0 {
+		return nil
+	}
+
+	return sleepContext(ctx, l.reserve(u.Host, interval, burst))
+}
+
+// reserve takes a token from host's bucket and returns how long the
+// caller has to wait for it.
+func (l *hostLimiter) reserve(host string, interval time.Duration, burst int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+float64(now.Sub(b.last))/float64(interval))
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(interval))
+}
+
+// sleepContext waits for d, or returns ctx's error if it ends first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,359 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	cdpfetch "github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// ============================================================================
+// HEADLESS RENDERING
+// ============================================================================
+
+// renderer replaces the HTML of pages with the DOM a headless Chrome
+// renders from them, so single-page apps that ship an empty shell still
+// produce titles, headings and links. The status code and headers come
+// from the crawler's own request as usual; only successful HTML bodies
+// are swapped. A page whose rendering fails keeps its plain body.
+//
+// Chrome never goes to the network itself. Every request a page makes is
+// intercepted: the page is served the response the crawler already
+// fetched, and its scripts, stylesheets and XHR are fetched through the
+// crawler's client, with its cookies, -header, -proxies, robots.txt and
+// host rate limit. Images, media and fonts don't change the DOM and are
+// not loaded. One Chrome process renders at most -render-concurrency
+// pages at a time, each in its own tab.
+type renderer struct {
+	client   *Client
+	all      bool         // -render: every page
+	patterns []URLPattern // -render-pattern: matching pages only
+	wait     time.Duration
+	timeout  time.Duration
+	slots    chan struct{}
+
+	browser  context.Context // started with the first page
+	stop     context.CancelFunc
+	start    sync.Once
+	startErr error
+}
+
+// chromeNames are looked up in PATH when -render-chrome isn't set.
+var chromeNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// renderProxy is where Chrome would send requests the crawler didn't
+// intercept; nothing listens there, so none get out.
+const renderProxy = "http://127.0.0.1:9"
+
+func newRenderer(client *Client, all bool, patterns []string, chrome string, wait, timeout time.Duration, concurrency int) (*renderer, error) {
+	if chrome == "" {
+		for _, name := range chromeNames {
+			if path, err := exec.LookPath(name); err == nil {
+				chrome = path
+				break
+			}
+		}
+		if chrome == "" {
+			return nil, errors.New("no Chrome or Chromium found in PATH, set -render-chrome")
+		}
+	}
+
+	r := &renderer{
+		client:  client,
+		all:     all,
+		wait:    wait,
+		timeout: timeout,
+		slots:   make(chan struct{}, max(concurrency, 1)),
+	}
+	for _, pattern := range patterns {
+		p, err := CompileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, p)
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(chrome),
+		chromedp.ProxyServer(renderProxy),
+		chromedp.Flag("hide-scrollbars", true),
+		chromedp.Flag("mute-audio", true),
+	)
+	if os.Geteuid() == 0 {
+		// Chrome refuses to start as root with its sandbox on, as in
+		// most containers.
+		opts = append(opts, chromedp.NoSandbox)
+	}
+	alloc, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	browser, cancelBrowser := chromedp.NewContext(alloc)
+	r.browser = browser
+	r.stop = func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+	return r, nil
+}
+
+// Close stops Chrome.
+func (r *renderer) Close() {
+	r.stop()
+}
+
+// Applies reports whether the page at rawURL is rendered.
+func (r *renderer) Applies(rawURL string) bool {
+	if r.all {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, p := range r.patterns {
+		if p.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render swaps the body of a successful HTML response for the DOM Chrome
+// renders from it. Other responses, and bodies over -max-body-bytes, are
+// left as they are.
+func (r *renderer) Render(ctx context.Context, resp *http.Response) {
+	if resp.StatusCode != http.StatusOK || !IsHTML(ContentType(resp, nil)) {
+		return
+	}
+
+	limit := r.client.config.MaxBodyBytes
+	reader := io.Reader(resp.Body)
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	switch {
+	case err != nil:
+		// Whoever reads the body gets the error.
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), errReader{err}), resp.Body}
+		return
+	case limit > 0 && int64(len(body)) > limit:
+		// Too large to render; read on as if nothing had been taken.
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	pageURL := resp.Request.URL.String()
+	dom, err := r.renderDOM(ctx, resp, body)
+	if err != nil {
+		slog.Warn("failed to render page, keeping its plain HTML", "url", pageURL, "error", err)
+		return
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(dom))
+	resp.ContentLength = int64(len(dom))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(dom)))
+	if mark, ok := ctx.Value(renderedKey{}).(*atomic.Bool); ok {
+		mark.Store(true)
+	}
+	r.client.renderedPages.Add(1)
+}
+
+// renderDOM loads the page in a new tab, serving it body, and returns the
+// serialized DOM once the page has had -render-wait of virtual time to
+// run its scripts after loading.
+func (r *renderer) renderDOM(ctx context.Context, resp *http.Response, body []byte) ([]byte, error) {
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Tabs only share a Chrome once it is running.
+	r.start.Do(func() { r.startErr = chromedp.Run(r.browser) })
+	if r.startErr != nil {
+		return nil, fmt.Errorf("failed to start chrome: %w", r.startErr)
+	}
+
+	tab, cancel := chromedp.NewContext(r.browser)
+	defer cancel()
+	tab, cancelTimeout := context.WithTimeout(tab, r.timeout)
+	defer cancelTimeout()
+	defer context.AfterFunc(ctx, cancel)()
+
+	var served atomic.Bool
+	expired := make(chan struct{})
+	var expiredOnce sync.Once
+	chromedp.ListenTarget(tab, func(ev any) {
+		switch ev := ev.(type) {
+		case *cdpfetch.EventRequestPaused:
+			// The first document is the page itself; frames are
+			// fetched like any other request.
+			var action chromedp.Action
+			if ev.ResourceType == network.ResourceTypeDocument && served.CompareAndSwap(false, true) {
+				action = fulfill(ev.RequestID, resp, body)
+			}
+			go func() {
+				if action == nil {
+					action = r.fetchFor(ctx, ev)
+				}
+				if err := chromedp.Run(tab, action); err != nil && tab.Err() == nil {
+					slog.Debug("failed to answer render request", "url", ev.Request.URL, "error", err)
+				}
+			}()
+		case *emulation.EventVirtualTimeBudgetExpired:
+			expiredOnce.Do(func() { close(expired) })
+		}
+	})
+
+	err := chromedp.Run(tab,
+		cdpfetch.Enable(),
+		emulation.SetUserAgentOverride(resp.Request.Header.Get("User-Agent")),
+		chromedp.Navigate(resp.Request.URL.String()),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := emulation.SetVirtualTimePolicy(emulation.VirtualTimePolicyPauseIfNetworkFetchesPending).
+				WithBudget(float64(r.wait.Milliseconds())).
+				Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-expired:
+	case <-tab.Done():
+		return nil, tab.Err()
+	}
+
+	var dom string
+	if err := chromedp.Run(tab, chromedp.OuterHTML("html", &dom, chromedp.ByQuery)); err != nil {
+		return nil, err
+	}
+	if dom == "" {
+		return nil, errors.New("chrome returned an empty DOM")
+	}
+	return []byte(dom), nil
+}
+
+// fetchFor fetches a request a rendered page makes through the crawler's
+// client and returns the action answering it. The page's own request
+// still holds its host slot, so only the rate limit is waited for;
+// taking a slot too could wait for the page forever.
+func (r *renderer) fetchFor(ctx context.Context, ev *cdpfetch.EventRequestPaused) chromedp.Action {
+	blocked := cdpfetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient)
+	switch ev.ResourceType {
+	case network.ResourceTypeImage, network.ResourceTypeMedia, network.ResourceTypeFont:
+		return blocked
+	}
+
+	target := ev.Request.URL
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		return blocked
+	}
+	if allowed, err := r.client.Allowed(ctx, target); err != nil || !allowed {
+		return blocked
+	}
+	if err := r.client.limiter.Wait(ctx, target); err != nil {
+		return blocked
+	}
+
+	var payload bytes.Buffer
+	for _, entry := range ev.Request.PostDataEntries {
+		if data, err := base64.StdEncoding.DecodeString(entry.Bytes); err == nil {
+			payload.Write(data)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, ev.Request.Method, target, &payload)
+	if err != nil {
+		return blocked
+	}
+	for name, value := range ev.Request.Headers {
+		// Cookies come from the crawler's jar, and compression is left
+		// to net/http.
+		if !strings.EqualFold(name, "Cookie") && !strings.EqualFold(name, "Accept-Encoding") {
+			req.Header.Set(name, fmt.Sprint(value))
+		}
+	}
+	if err := r.client.interceptRequest(req); err != nil {
+		return blocked
+	}
+
+	resp, err := r.client.http.Do(req)
+	if err != nil {
+		return cdpfetch.FailRequest(ev.RequestID, network.ErrorReasonFailed)
+	}
+	defer resp.Body.Close()
+	reader := io.Reader(resp.Body)
+	if limit := r.client.config.MaxBodyBytes; limit > 0 {
+		reader = io.LimitReader(resp.Body, limit)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return cdpfetch.FailRequest(ev.RequestID, network.ErrorReasonFailed)
+	}
+	return fulfill(ev.RequestID, resp, body)
+}
+
+// fulfill answers a paused request with resp's status and headers and
+// body.
+func fulfill(id cdpfetch.RequestID, resp *http.Response, body []byte) chromedp.Action {
+	var headers []*cdpfetch.HeaderEntry
+	for name, values := range resp.Header {
+		// Chrome takes the length from body, which may have been cut
+		// off at -max-body-bytes.
+		if strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		for _, value := range values {
+			headers = append(headers, &cdpfetch.HeaderEntry{Name: name, Value: value})
+		}
+	}
+	return cdpfetch.FulfillRequest(id, int64(resp.StatusCode)).
+		WithResponseHeaders(headers).
+		WithBody(base64.StdEncoding.EncodeToString(body))
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader fails every read with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+type renderedKey struct{}
+
+// withRenderMark returns a context whose response is marked once its
+// body has been rendered.
+func withRenderMark(ctx context.Context) context.Context {
+	return context.WithValue(ctx, renderedKey{}, new(atomic.Bool))
+}
+
+// Rendered reports whether the body of the response to req was
+// rendered by Chrome.
+func Rendered(req *http.Request) bool {
+	mark, ok := req.Context().Value(renderedKey{}).(*atomic.Bool)
+	return ok && mark.Load()
+}
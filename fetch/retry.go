@@ -0,0 +1,109 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ============================================================================
+// RETRIES
+// ============================================================================
+
+// Requests that fail with a transient error are retried up to
+// -max-attempts times in all, waiting -retry-backoff, then twice as long
+// after each further failure (capped at -retry-max-backoff), with jitter
+// so that workers that failed together don't retry together.
+//
+// A 429 or 503 with Retry-After pauses the whole host for that long
+// (at most -max-cooldown) instead, and the request is tried again once
+// the host cools down. Such retries don't count towards -max-attempts,
+// up to maxCooldowns per URL.
+
+// maxCooldowns bounds the Retry-After pauses a single URL may wait out.
+const maxCooldowns = 10
+
+type attemptKey struct{}
+
+// withAttempt returns a context recording that requests made with it are
+// the n-th attempt.
+func withAttempt(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, n)
+}
+
+// Attempts returns which attempt req was, 1 if not recorded.
+func Attempts(req *http.Request) int {
+	if req != nil {
+		if n, ok := req.Context().Value(attemptKey{}).(int); ok {
+			return n
+		}
+	}
+	return 1
+}
+
+// retryable reports whether a request that ended with resp or err may
+// succeed if tried again: connection errors, timeouts, 429 and 5xx
+// gateway/availability errors. Unknown hosts, certificate errors and
+// errors from the crawler's own limits are permanent.
+func retryable(resp *http.Response, err error) bool {
+	if err == nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrDisallowed) ||
+		errors.Is(err, ErrByteBudget) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryDelay returns how long to wait after the given failed attempt: the
+// exponential backoff, capped at -retry-max-backoff, with up to half of
+// it taken off at random.
+func (c *Client) retryDelay(attempt int) time.Duration {
+	backoff := c.config.RetryBackoff
+	for i := 1; i < attempt && backoff < c.config.RetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, c.config.RetryMaxBackoff)
+	if backoff > 0 {
+		backoff -= time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+	}
+	return backoff
+}
+
+// cooldown returns how long resp asks its host to be left alone: the
+// Retry-After of a 429 or 503, in seconds or as an HTTP date.
+func cooldown(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,318 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// ROBOTS.TXT
+// ============================================================================
+
+// The request User-Agent (-user-agent, or rotated from userAgents) is what
+// servers see. Robots rules are always matched against the stable
+// -robots-ua product token instead, so rotating the request UA never
+// changes which robots.txt group applies.
+
+// ErrDisallowed is returned for requests robots.txt doesn't allow.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// Largest robots.txt read, as recommended by RFC 9309.
+const maxRobotsSize = 500 << 10
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules is a parsed robots.txt. A nil *robotsRules allows
+// everything; disallowAll is used when robots.txt could not be fetched.
+type robotsRules struct {
+	groups      []robotsGroup
+	disallowAll bool
+}
+
+// parseRobots reads the groups of a robots.txt. Consecutive user-agent
+// lines start one group; unknown fields such as Sitemap are ignored.
+func parseRobots(r io.Reader) *robotsRules {
+	rules := &robotsRules{}
+	var current *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				rules.groups = append(rules.groups, robotsGroup{})
+				current = &rules.groups[len(rules.groups)-1]
+				inAgents = true
+			}
+			// An empty user-agent names no crawler, so it matches none.
+			if value != "" {
+				current.agents = append(current.agents, value)
+			}
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || (value == "" && key == "disallow") {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      compileRobotsPattern(value),
+			})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return rules
+}
+
+// group returns the rules that apply to token: those of the groups whose
+// user-agent is token, compared case-insensitively as RFC 9309 asks, or
+// the "*" groups when none match. Groups naming the same agent are
+// merged.
+func (r *robotsRules) group(token string) robotsGroup {
+	named := func(agent string) bool { return agent != "*" && strings.EqualFold(agent, token) }
+
+	specific := false
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if named(agent) {
+				specific = true
+			}
+		}
+	}
+
+	var merged robotsGroup
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if (specific && named(agent)) || (!specific && agent == "*") {
+				merged.rules = append(merged.rules, g.rules...)
+				merged.crawlDelay = max(merged.crawlDelay, g.crawlDelay)
+				break
+			}
+		}
+	}
+	return merged
+}
+
+// CrawlDelay returns the Crawl-delay that applies to token, 0 if none.
+func (r *robotsRules) CrawlDelay(token string) time.Duration {
+	if r == nil || r.disallowAll {
+		return 0
+	}
+	return r.group(token).crawlDelay
+}
+
+// Allowed reports whether token may fetch path (with query). The longest
+// matching rule wins and Allow wins ties.
+func (r *robotsRules) Allowed(token, path string) bool {
+	if r == nil {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.group(token).rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// compileRobotsPattern turns a robots path pattern into a regexp: *
+// matches any run of characters and a trailing $ anchors the end.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsRetryAfter is how long an unreachable robots.txt keeps its host
+// disallowed before it is fetched again.
+const robotsRetryAfter = time.Minute
+
+// fetchRobotsTxt requests robots.txt directly, bypassing Get so
+// fetching it is never itself delayed or blocked. Following RFC 9309, a
+// 4xx means no restrictions, while a 5xx or a network error leaves the
+// whole host disallowed. Transient failures are retried like pages are,
+// up to -max-attempts times.
+func (c *Client) fetchRobotsTxt(ctx context.Context, robotsURL string) (*robotsRules, error) {
+	for attempt := 1; ; attempt++ {
+		rules, retry, err := c.fetchRobotsTxtOnce(ctx, robotsURL)
+		if err == nil || !retry || attempt >= c.config.MaxAttempts {
+			return rules, err
+		}
+		select {
+		case <-time.After(c.retryDelay(attempt)):
+		case <-ctx.Done():
+			return rules, err
+		}
+	}
+}
+
+// fetchRobotsTxtOnce makes a single robots.txt request, and reports
+// whether a failure is worth retrying.
+func (c *Client) fetchRobotsTxtOnce(ctx context.Context, robotsURL string) (*robotsRules, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent())
+	req = c.applyClientProfile(req)
+	c.applyHeaders(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &robotsRules{disallowAll: true}, retryable(nil, err), err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return parseRobots(resp.Body), false, nil
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
+		return nil, false, nil
+	default:
+		return &robotsRules{disallowAll: true}, retryable(resp, nil),
+			fmt.Errorf("robots.txt returned status %d", resp.StatusCode)
+	}
+}
+
+// robotsCache fetches robots.txt once per host and answers whether URLs
+// may be crawled by the -robots-ua token. A robots.txt that couldn't be
+// reached is only cached for robotsRetryAfter, so a passing outage
+// doesn't keep its host disallowed for the whole run.
+type robotsCache struct {
+	client *Client
+	mu     sync.Mutex
+	token  string
+	hosts  map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready   chan struct{} // closed once rules is set
+	rules   *robotsRules
+	expires time.Time // when the fetch failed, when to try it again
+}
+
+// stale reports whether e's fetch failed long enough ago to try again.
+func (e *robotsEntry) stale() bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && time.Now().After(e.expires)
+	default:
+		return false
+	}
+}
+
+func newRobotsCache(client *Client, token string) *robotsCache {
+	return &robotsCache{client: client, token: token, hosts: make(map[string]*robotsEntry)}
+}
+
+// rulesFor returns the robots rules of u's host, fetching them on first
+// use. Concurrent callers for the same host share one fetch.
+func (c *robotsCache) rulesFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.hosts[key]
+	if !ok || entry.stale() {
+		entry, ok = &robotsEntry{ready: make(chan struct{})}, false
+		c.hosts[key] = entry
+	}
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+			return entry.rules, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	rules, err := c.client.fetchRobotsTxt(ctx, key+"/robots.txt")
+	if err != nil {
+		slog.Warn("robots.txt unavailable, host disallowed", "host", u.Host, "retry_after", robotsRetryAfter, "error", err)
+		entry.expires = time.Now().Add(robotsRetryAfter)
+	}
+	entry.rules = rules
+	close(entry.ready)
+	return rules, nil
+}
+
+// CrawlDelay returns the Crawl-delay u's host asks of the -robots-ua
+// token, 0 if none.
+func (c *robotsCache) CrawlDelay(ctx context.Context, u *url.URL) (time.Duration, error) {
+	rules, err := c.rulesFor(ctx, u)
+	if err != nil {
+		return 0, err
+	}
+	return rules.CrawlDelay(c.token), nil
+}
+
+// Allowed reports whether rawURL may be crawled.
+func (c *robotsCache) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true, nil
+	}
+	rules, err := c.rulesFor(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return rules.Allowed(c.token, u.RequestURI()), nil
+}
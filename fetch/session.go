@@ -0,0 +1,109 @@
+package fetch
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ============================================================================
+// REQUEST HEADERS AND COOKIES
+// ============================================================================
+
+// ParseHeader splits a -header value of the form "Name: value".
+func ParseHeader(v string) ([2]string, error) {
+	name, value, ok := strings.Cut(v, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return [2]string{}, fmt.Errorf("invalid header %q (want Name: value)", v)
+	}
+	return [2]string{http.CanonicalHeaderKey(name), strings.TrimSpace(value)}, nil
+}
+
+// applyHeaders sets the -header headers on req, replacing the profile's.
+// A Host header sets the request's host instead.
+func (c *Client) applyHeaders(req *http.Request) {
+	for _, h := range c.config.Headers {
+		if h[0] == "Host" {
+			req.Host = h[1]
+			continue
+		}
+		req.Header.Set(h[0], h[1])
+	}
+}
+
+// newCookieJar returns the jar holding the cookies of -cookies and
+// -login-url, and those the crawled sites set in return.
+func newCookieJar() (*cookiejar.Jar, error) {
+	return cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+}
+
+// loadCookieFile adds the cookies of a Netscape cookies.txt file, as
+// exported by browsers and written by curl -c, to jar. Expired cookies
+// are skipped; an expiry of 0 marks a session cookie.
+func loadCookieFile(jar http.CookieJar, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open cookie file: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	loaded, lineNo := 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return loaded, fmt.Errorf("cookie file %s line %d: want 7 tab-separated fields, got %d", path, lineNo, len(fields))
+		}
+		domain, subdomains, cookiePath, secure, expires, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     cookiePath,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if unix, err := strconv.ParseInt(expires, 10, 64); err == nil && unix > 0 {
+			cookie.Expires = time.Unix(unix, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		host := strings.TrimPrefix(domain, ".")
+		if strings.EqualFold(subdomains, "TRUE") {
+			// Without a Domain the jar keeps the cookie for host only.
+			cookie.Domain = host
+		}
+
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cookiePath}, []*http.Cookie{cookie})
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return loaded, fmt.Errorf("failed to read cookie file: %w", err)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,154 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// REQUEST TIMINGS
+// ============================================================================
+
+// phaseTimings collects where the time of one page request went, filled
+// in by an httptrace.ClientTrace. After redirects the phases describe the
+// last hop, while the total spans every hop and reading the body.
+type phaseTimings struct {
+	mu sync.Mutex
+
+	start     time.Time // request start, before the first hop
+	end       time.Time // set by finish once the body has been read
+	hopStart  time.Time
+	dnsStart  time.Time
+	connStart time.Time
+	tlsStart  time.Time
+
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration // from asking for a connection to the first response byte
+}
+
+type phaseTimingsKey struct{}
+
+// withPhaseTimings returns a context that traces requests made with it.
+func withPhaseTimings(ctx context.Context) context.Context {
+	t := &phaseTimings{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.hopStart = time.Now()
+			t.DNS, t.Connect, t.TLS, t.TTFB = 0, 0, 0, 0
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connStart.Before(t.hopStart) {
+				t.connStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// With several addresses dialed in parallel, the first
+			// successful dial counts.
+			if err == nil && t.Connect == 0 {
+				t.Connect = time.Since(t.connStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.TLS = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.TTFB = time.Since(t.hopStart)
+		},
+	}
+	ctx = context.WithValue(ctx, phaseTimingsKey{}, t)
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// phaseTimingsFrom returns the timings traced for req, or nil when the
+// request wasn't traced.
+func phaseTimingsFrom(req *http.Request) *phaseTimings {
+	if req == nil {
+		return nil
+	}
+	t, _ := req.Context().Value(phaseTimingsKey{}).(*phaseTimings)
+	return t
+}
+
+// FinishTimings ends the total of req's timings at the current time, so
+// a page parsed later, after waiting in the worklist, isn't charged for
+// the wait.
+func FinishTimings(req *http.Request) {
+	if t := phaseTimingsFrom(req); t != nil {
+		t.finish()
+	}
+}
+
+func (t *phaseTimings) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.end.IsZero() {
+		t.end = time.Now()
+	}
+}
+
+// Timings are the phases of a page request, in milliseconds.
+type Timings struct {
+	DNS     int64
+	Connect int64
+	TLS     int64
+	TTFB    int64
+	Total   int64
+}
+
+// Timings returns the timings traced for req, taking the total up to
+// FinishTimings, or up to now if it wasn't called. Time to first byte
+// and the total are always kept; the DNS, connect and TLS phases only
+// with -trace-timings. It reports false when req wasn't traced.
+func (c *Client) Timings(req *http.Request) (Timings, bool) {
+	t := phaseTimingsFrom(req)
+	if t == nil {
+		return Timings{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	end := t.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	timings := Timings{
+		TTFB:  t.TTFB.Milliseconds(),
+		Total: end.Sub(t.start).Milliseconds(),
+	}
+	if c.config.TraceTimings {
+		timings.DNS = t.DNS.Milliseconds()
+		timings.Connect = t.Connect.Milliseconds()
+		timings.TLS = t.TLS.Milliseconds()
+	}
+	return timings, true
+}
@@ -0,0 +1,108 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ============================================================================
+// CLIENT PROFILES
+// ============================================================================
+
+// A clientProfile sets the headers sent with every request. The default
+// "go" profile is the plain Go client. The "browser" profile sends the
+// headers a desktop browser sends with a page navigation, so cooperative
+// sites serve the same HTML they serve browsers; it exists for authorized
+// crawling and must not be used to get around access controls. Neither
+// profile changes the TLS handshake or the order headers are written in.
+type clientProfile struct {
+	Name    string
+	Headers [][2]string
+}
+
+var clientProfiles = map[string]clientProfile{
+	"go": {Name: "go"},
+	"browser": {
+		Name: "browser",
+		Headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	},
+}
+
+// CheckClientProfile fails for an unknown -client-profile.
+func CheckClientProfile(name string) error {
+	if _, ok := clientProfiles[name]; !ok {
+		return fmt.Errorf("unknown client profile %q (want go or browser)", name)
+	}
+	return nil
+}
+
+// buildClient sets up the one client every request goes through, so
+// connections are kept alive and reused across workers. Requests are
+// routed through the -proxies pool when there is one.
+func (c *Client) buildClient(jar http.CookieJar) {
+	var rt http.RoundTripper = c.baseTransport()
+	if c.proxies != nil {
+		rt = c.proxies
+	}
+	if c.wrapTransport != nil {
+		rt = c.wrapTransport(rt)
+	}
+	c.transport = rt
+	c.http = &http.Client{Timeout: c.config.RequestTimeout, Transport: rt, CheckRedirect: c.checkRedirect, Jar: jar}
+}
+
+// checkRedirect stops following redirects when a URL repeats or after
+// -max-redirects hops. The last redirect response is then returned as
+// the page instead of an error, so the chain can still be recorded.
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.config.MaxRedirects > 0 && len(via) >= c.config.MaxRedirects {
+		return http.ErrUseLastResponse
+	}
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return http.ErrUseLastResponse
+		}
+	}
+	return nil
+}
+
+// baseTransport returns the direct transport for the configured profile,
+// pooling connections as set by -max-idle-conns, -max-idle-conns-per-host
+// and -idle-conn-timeout.
+func (c *Client) baseTransport() *http.Transport {
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     c.config.HTTP2,
+		MaxIdleConns:          c.config.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.config.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if !c.config.HTTP2 {
+		// A non-nil, empty map turns off HTTP/2 negotiation.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// applyClientProfile sets the profile's headers on req. It returns the
+// request to send.
+func (c *Client) applyClientProfile(req *http.Request) *http.Request {
+	for _, h := range clientProfiles[c.config.ClientProfile].Headers {
+		req.Header.Set(h[0], h[1])
+	}
+	return req
+}
@@ -0,0 +1,74 @@
+package fetch
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// HOST WARM-UP
+// ============================================================================
+
+// hostWarmup delays the first content request to each newly encountered
+// host: robots.txt is fetched first, then the crawler waits -warmup-delay
+// before any page of that host is requested. Requests to hosts already
+// warmed up are not delayed, so this is separate from any steady-state
+// politeness delay.
+type hostWarmup struct {
+	client *Client
+	mu     sync.Mutex
+	delay  time.Duration
+	hosts  map[string]chan struct{} // closed once the host is warmed up
+}
+
+func newHostWarmup(client *Client, delay time.Duration) *hostWarmup {
+	return &hostWarmup{client: client, delay: delay, hosts: make(map[string]chan struct{})}
+}
+
+// Wait returns once rawURL's host has been warmed up. The first caller for
+// a host does the warm-up; concurrent callers for the same host wait for
+// it to finish.
+func (h *hostWarmup) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	h.mu.Lock()
+	ready, seen := h.hosts[u.Host]
+	if !seen {
+		ready = make(chan struct{})
+		h.hosts[u.Host] = ready
+	}
+	h.mu.Unlock()
+
+	if seen {
+		select {
+		case <-ready:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	defer close(ready)
+
+	if h.client.robots != nil {
+		h.client.robots.rulesFor(ctx, u)
+	} else if _, _, err := h.client.fetchRobotsTxtOnce(ctx, u.Scheme+"://"+u.Host+"/robots.txt"); err != nil {
+		slog.Debug("robots.txt fetch failed during warm-up", "host", u.Host, "error", err)
+	}
+
+	slog.Info("new host, warming up", "host", u.Host, "delay", h.delay)
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// HTML AUDIT REPORT
+// ============================================================================
+
+// Title and meta description lengths outside these bounds are flagged,
+// roughly what search results show before cutting them off.
+const (
+	minTitleLength       = 30
+	maxTitleLength       = 60
+	minDescriptionLength = 70
+	maxDescriptionLength = 160
+)
+
+// auditListed caps the pages listed per issue; the rest are counted.
+const auditListed = 100
+
+// auditSlowest is how many of the slowest pages are listed.
+const auditSlowest = 20
+
+// auditPages is one issue's pages, capped at auditListed.
+type auditPages struct {
+	Total int
+	Pages []auditPage
+}
+
+type auditPage struct {
+	URL    string
+	Detail string
+}
+
+// More is how many pages were left out of the list.
+func (a auditPages) More() int { return a.Total - len(a.Pages) }
+
+type auditStatus struct {
+	Code  int
+	Class string // status class, for colouring: s2, s3, s4, s5, s0 for failed requests
+	Pages int
+}
+
+type auditBrokenTarget struct {
+	URL    string
+	Status string
+	From   []string
+}
+
+// auditReport is the data behind the HTML report of one run.
+type auditReport struct {
+	RunID     string
+	StartURL  string
+	Generated time.Time
+
+	Pages       int
+	HTMLPages   int // 2xx HTML pages, the ones content checks apply to
+	StatusCodes []auditStatus
+
+	MissingTitles      auditPages
+	ShortTitles        auditPages
+	LongTitles         auditPages
+	DuplicateTitles    []storage.DuplicateGroup
+	MissingDescription auditPages
+	ShortDescription   auditPages
+	LongDescription    auditPages
+	DuplicateDescs     []storage.DuplicateGroup
+	MissingH1          auditPages
+	MultipleH1         auditPages
+
+	Timed   bool // some pages have timings
+	Slowest []auditPage
+
+	BrokenTargets []auditBrokenTarget
+	BrokenLinks   int
+
+	MinTitle, MaxTitle int
+	MinDesc, MaxDesc   int
+}
+
+// htmlReportPath returns where the report of runID goes: path itself,
+// or with the run ID added before the extension when several runs are
+// reported at once.
+func htmlReportPath(path, runID string, runs int) string {
+	if runs < 2 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + runID + ext
+}
+
+// writeHTMLReport renders the audit report of runID as a standalone HTML
+// file at path.
+func writeHTMLReport(db *gorm.DB, path, runID string) error {
+	r, err := loadAuditReport(db, runID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create HTML report: %w", err)
+	}
+	if err := auditTemplate.Execute(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return f.Close()
+}
+
+func loadAuditReport(db *gorm.DB, runID string) (*auditReport, error) {
+	r := &auditReport{
+		RunID:     runID,
+		Generated: time.Now(),
+		MinTitle:  minTitleLength,
+		MaxTitle:  maxTitleLength,
+		MinDesc:   minDescriptionLength,
+		MaxDesc:   maxDescriptionLength,
+	}
+	pages := func() *gorm.DB { return db.Model(&storage.Page{}).Scopes(storage.RunScope(runID)) }
+	htmlPages := func() *gorm.DB { return pages().Where(storage.AuditHTMLPages) }
+
+	var stats storage.CrawlStats
+	if err := db.Where("run_id = ?", runID).Order("id DESC").Limit(1).Find(&stats).Error; err != nil {
+		return nil, err
+	}
+	r.StartURL = stats.StartURL
+
+	var total, html int64
+	if err := pages().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if err := htmlPages().Count(&html).Error; err != nil {
+		return nil, err
+	}
+	r.Pages, r.HTMLPages = int(total), int(html)
+
+	var codes []struct {
+		StatusCode int
+		Pages      int
+	}
+	if err := pages().Select("status_code, COUNT(*) AS pages").Group("status_code").Order("status_code").Scan(&codes).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		class := fmt.Sprintf("s%d", c.StatusCode/100)
+		r.StatusCodes = append(r.StatusCodes, auditStatus{Code: c.StatusCode, Class: class, Pages: c.Pages})
+	}
+
+	var err error
+	list := func(dst *auditPages, detail, where string, args ...any) {
+		if err != nil {
+			return
+		}
+		*dst, err = auditList(func() *gorm.DB { return htmlPages().Where(where, args...) }, detail)
+	}
+	list(&r.MissingTitles, "", "title = ''")
+	list(&r.ShortTitles, "title", "title <> '' AND LENGTH(title) < ?", minTitleLength)
+	list(&r.LongTitles, "title", "LENGTH(title) > ?", maxTitleLength)
+	list(&r.MissingDescription, "", "meta_description = ''")
+	list(&r.ShortDescription, "meta_description", "meta_description <> '' AND LENGTH(meta_description) < ?", minDescriptionLength)
+	list(&r.LongDescription, "meta_description", "LENGTH(meta_description) > ?", maxDescriptionLength)
+	list(&r.MissingH1, "", "h1_count = 0")
+	list(&r.MultipleH1, "h1_count", "h1_count > 1")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.UpdateDuplicates(db, runID); err != nil {
+		return nil, err
+	}
+	if r.DuplicateTitles, err = storage.LoadDuplicates(db, runID, "title"); err != nil {
+		return nil, err
+	}
+	if r.DuplicateDescs, err = storage.LoadDuplicates(db, runID, "meta_description"); err != nil {
+		return nil, err
+	}
+
+	var slowest []storage.Page
+	if err := pages().Where("total_millis > 0").Select("url", "total_millis").
+		Order("total_millis DESC").Limit(auditSlowest).Find(&slowest).Error; err != nil {
+		return nil, err
+	}
+	r.Timed = len(slowest) > 0
+	for _, p := range slowest {
+		r.Slowest = append(r.Slowest, auditPage{URL: p.URL, Detail: fmt.Sprintf("%d ms", p.TotalMillis)})
+	}
+
+	if err := storage.UpdateBrokenLinks(db, runID); err != nil {
+		return nil, err
+	}
+	var broken []storage.BrokenLink
+	if err := db.Where("run_id = ?", runID).Order("to_url, from_url").Find(&broken).Error; err != nil {
+		return nil, err
+	}
+	r.BrokenLinks = len(broken)
+	for i, l := range broken {
+		if i == 0 || broken[i-1].ToURL != l.ToURL {
+			status := fmt.Sprint(l.StatusCode)
+			if l.StatusCode == 0 {
+				status = l.Error
+			}
+			r.BrokenTargets = append(r.BrokenTargets, auditBrokenTarget{URL: l.ToURL, Status: status})
+		}
+		t := &r.BrokenTargets[len(r.BrokenTargets)-1]
+		t.From = append(t.From, l.FromURL)
+	}
+	return r, nil
+}
+
+// auditList returns the pages q selects, ordered by URL, with the value
+// of the detail column when set.
+func auditList(q func() *gorm.DB, detail string) (auditPages, error) {
+	var total int64
+	if err := q().Count(&total).Error; err != nil {
+		return auditPages{}, err
+	}
+
+	columns := "url"
+	if detail != "" {
+		columns += ", " + detail + " AS detail"
+	} else {
+		columns += ", '' AS detail"
+	}
+	var rows []auditPage
+	err := q().Select(columns).Order("url").Limit(auditListed).Scan(&rows).Error
+	return auditPages{Total: int(total), Pages: rows}, err
+}
+
+// auditTemplate renders an auditReport as a single page with inline CSS,
+// so the file can be mailed or archived as it is. The "pages" and
+// "groups" blocks take their arguments as a list.
+var auditTemplate = template.Must(template.New("audit").Funcs(template.FuncMap{
+	"list": func(v ...any) []any { return v },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>SEO audit: {{.RunID}}</title>
+<style>
+body { font: 14px/1.5 system-ui, sans-serif; max-width: 1100px; margin: 2em auto; padding: 0 1em; color: #222; }
+h1 { margin-bottom: 0; }
+h2 { border-bottom: 1px solid #ddd; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; margin: .5em 0; }
+th, td { text-align: left; padding: .25em .5em; border-bottom: 1px solid #eee; vertical-align: top; word-break: break-all; }
+th { background: #f6f6f6; }
+.meta { color: #666; }
+.ok { color: #2a7a2a; }
+.count { font-weight: bold; }
+.s2 { color: #2a7a2a; } .s3 { color: #8a6d00; } .s4, .s5, .s0 { color: #b00020; }
+details { margin: .5em 0; }
+summary { cursor: pointer; }
+ul { margin: .25em 0; }
+</style>
+</head>
+<body>
+<h1>SEO audit</h1>
+<p class="meta">Run {{.RunID}}{{if .StartURL}} of {{.StartURL}}{{end}}, generated {{.Generated.Format "2006-01-02 15:04"}}.
+{{.Pages}} pages crawled, {{.HTMLPages}} successful HTML pages checked for content issues.</p>
+
+<h2>Status codes</h2>
+<table>
+<tr><th>Status</th><th>Pages</th></tr>
+{{range .StatusCodes}}<tr><td class="{{.Class}}">{{if .Code}}{{.Code}}{{else}}request failed{{end}}</td><td>{{.Pages}}</td></tr>
+{{end}}</table>
+
+<h2>Titles</h2>
+{{template "pages" (list "Missing title" .MissingTitles "")}}
+{{template "pages" (list (printf "Shorter than %d characters" .MinTitle) .ShortTitles "Title")}}
+{{template "pages" (list (printf "Longer than %d characters" .MaxTitle) .LongTitles "Title")}}
+{{template "groups" (list "Duplicate titles" .DuplicateTitles)}}
+
+<h2>Meta descriptions</h2>
+{{template "pages" (list "Missing meta description" .MissingDescription "")}}
+{{template "pages" (list (printf "Shorter than %d characters" .MinDesc) .ShortDescription "Description")}}
+{{template "pages" (list (printf "Longer than %d characters" .MaxDesc) .LongDescription "Description")}}
+{{template "groups" (list "Duplicate meta descriptions" .DuplicateDescs)}}
+
+<h2>H1 headings</h2>
+{{template "pages" (list "Missing h1" .MissingH1 "")}}
+{{template "pages" (list "Several h1s" .MultipleH1 "h1s")}}
+
+<h2>Slowest pages</h2>
+{{if .Timed}}<table>
+<tr><th>URL</th><th>Total time</th></tr>
+{{range .Slowest}}<tr><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{else}}<p class="meta">No timings recorded.</p>{{end}}
+
+<h2>Broken links</h2>
+{{if .BrokenTargets}}<p><span class="count">{{len .BrokenTargets}}</span> broken targets, {{.BrokenLinks}} internal links to them.</p>
+<table>
+<tr><th>Target</th><th>Status</th><th>Linked from</th></tr>
+{{range .BrokenTargets}}<tr><td>{{.URL}}</td><td class="s0">{{.Status}}</td><td><ul>{{range .From}}<li><a href="{{.}}">{{.}}</a></li>{{end}}</ul></td></tr>
+{{end}}</table>
+{{else}}<p class="ok">No broken internal links.</p>{{end}}
+</body>
+</html>
+{{define "pages"}}{{$title := index . 0}}{{$pages := index . 1}}{{$detail := index . 2}}
+{{if $pages.Total}}<details>
+<summary>{{$title}}: <span class="count">{{$pages.Total}}</span> pages</summary>
+<table>
+<tr><th>URL</th>{{if $detail}}<th>{{$detail}}</th>{{end}}</tr>
+{{range $pages.Pages}}<tr><td><a href="{{.URL}}">{{.URL}}</a></td>{{if $detail}}<td>{{.Detail}}</td>{{end}}</tr>
+{{end}}</table>
+{{if $pages.More}}<p class="meta">and {{$pages.More}} more</p>{{end}}
+</details>
+{{else}}<p class="ok">{{$title}}: none</p>{{end}}
+{{end}}
+{{define "groups"}}{{$title := index . 0}}{{$groups := index . 1}}
+{{if $groups}}<details>
+<summary>{{$title}}: <span class="count">{{len $groups}}</span> shared by several pages</summary>
+<table>
+<tr><th>Value</th><th>Pages</th></tr>
+{{range $groups}}<tr><td>{{.Value}}</td><td><ul>{{range .URLs}}<li><a href="{{.}}">{{.}}</a></li>{{end}}</ul></td></tr>
+{{end}}</table>
+</details>
+{{else}}<p class="ok">{{$title}}: none</p>{{end}}
+{{end}}
+`))
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"crawl-guardian.com/crawler"
+)
+
+// ============================================================================
+// INSPECT MODE
+// ============================================================================
+
+// inspectURL fetches a single page, runs the parser and writes the result
+// as JSON. No database, workers or discovery are involved, but the
+// request helpers (signing, cookies, login, robots.txt) are set up as for
+// a crawl.
+func inspectURL(ctx context.Context, c *crawler.Crawler, url string, w io.Writer) error {
+	data, err := c.Inspect(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
@@ -1,391 +1,206 @@
 package main
 
 import (
-    "context"
-    "fmt"
-    "io"
-    "log"
-    "log/slog"
-    "math/rand"
-    "net/http"
-    "net/url"
-    "sync"
-    "sync/atomic"
-    "time"
-
-    "golang.org/x/net/html"
-    "github.com/glebarez/sqlite"//love you bro
-    "gorm.io/gorm"
-    "gorm.io/gorm/logger"
-    //_ "modernc.org/sqlite"  
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"crawl-guardian.com/crawler"
+	"crawl-guardian.com/storage"
 )
 
 // ============================================================================
-// DATABASE MODELS
-// ============================================================================
-
-type Page struct {
-	ID              uint      `gorm:"primaryKey"`
-	URL             string    `gorm:"uniqueIndex;not null"`
-	Title           string    `gorm:"size:500"`
-	H1              string    `gorm:"size:500"`
-	MetaDescription string    `gorm:"size:1000"`
-	StatusCode      int       `gorm:"index"`
-	CrawledAt       time.Time `gorm:"index"`
-	CreatedAt       time.Time
-}
-
-type CrawlStats struct {
-	ID           uint `gorm:"primaryKey"`
-	TotalPages   int
-	SuccessPages int
-	FailedPages  int
-	Duration     int64 // seconds
-	StartURL     string
-	CrawledAt    time.Time
-}
-
-// ============================================================================
-// SEO DATA & PARSER
+// MAIN
 // ============================================================================
 
-type SEOData struct {
-	URL             string
-	Title           string
-	H1              string
-	MetaDescription string
-	StatusCode      int
-}
-
-type Parser interface {
-	GetSEOData(resp *http.Response) (SEOData, error)
-}
-
-type DefaultParser struct{}
-
-func (p *DefaultParser) GetSEOData(resp *http.Response) (SEOData, error) {
-	data := SEOData{
-		URL:        resp.Request.URL.String(),
-		StatusCode: resp.StatusCode,
-	}
-
-	doc, err := html.Parse(resp.Body)
-	if err != nil {
-		return data, err
-	}
-
-	var extract func(*html.Node)
-	extract = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			switch n.Data {
-			case "title":
-				if n.FirstChild != nil {
-					data.Title = n.FirstChild.Data
-				}
-			case "h1":
-				if n.FirstChild != nil && data.H1 == "" {
-					data.H1 = n.FirstChild.Data
-				}
-			case "meta":
-				var name, content string
-				for _, attr := range n.Attr {
-					if attr.Key == "name" {
-						name = attr.Val
-					}
-					if attr.Key == "content" {
-						content = attr.Val
-					}
-				}
-				if name == "description" {
-					data.MetaDescription = content
-				}
+func main() {
+	config = parseFlags()
+
+	if config.Inspect || config.Expect != "" {
+		// Requests are made as in a crawl, signed, with the cookies and
+		// login session, and subject to robots.txt.
+		c := crawler.New(config.Config, nil, nil)
+		if config.Inspect {
+			err := inspectURL(context.Background(), c, config.SeedURL, os.Stdout)
+			c.Close()
+			if err != nil {
+				log.Fatal("inspect failed: ", err)
 			}
+			return
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			extract(c)
+
+		failed, err := checkExpectations(context.Background(), c, config.Expect, os.Stdout)
+		c.Close()
+		if err != nil {
+			log.Fatal(err)
 		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
 	}
-	extract(doc)
-
-	return data, nil
-}
-
-// ============================================================================
-// GLOBAL VARIABLES
-// ============================================================================
-
-var (
-	completedPages atomic.Int64
-	successPages   atomic.Int64
-	failedPages    atomic.Int64
-	totalPages     int
-)
-
-var userAgents = []string{
-	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-}
-
-// ============================================================================
-// DATABASE FUNCTIONS
-// ============================================================================
-
-func initDB() (*gorm.DB, error) {
-	 dbName := fmt.Sprintf("crawler_%s.db", time.Now().Format("20060102_150405"))
-    
-    db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{
-        Logger: logger.Default.LogMode(logger.Silent),
-    })
 
+	// Initialize DB
+	db, err := storage.Open(config.DBPath, storage.Pool{
+		MaxOpenConns:    config.DBMaxOpenConns,
+		MaxIdleConns:    config.DBMaxIdleConns,
+		ConnMaxLifetime: config.DBConnMaxLifetime,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		log.Fatal("failed to connect database:", err)
 	}
 
-	err = db.AutoMigrate(&Page{}, &CrawlStats{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	if config.ListCrawls {
+		if err := printCrawls(db, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	return db, nil
-}
-
-func savePage(db *gorm.DB, data SEOData) error {
-	page := Page{
-		URL:             data.URL,
-		Title:           data.Title,
-		H1:              data.H1,
-		MetaDescription: data.MetaDescription,
-		StatusCode:      data.StatusCode,
-		CrawledAt:       time.Now(),
+	if config.StatsHistory != "" {
+		if err := printStatsHistory(db, os.Stdout, config.StatsHistory, config.CSVOutput); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	result := db.Where(Page{URL: data.URL}).FirstOrCreate(&page)
-	return result.Error
-}
-
-func saveCrawlStats(db *gorm.DB, startURL string, duration time.Duration, total, success, failed int) error {
-	stats := CrawlStats{
-		TotalPages:   total,
-		SuccessPages: success,
-		FailedPages:  failed,
-		Duration:     int64(duration.Seconds()),
-		StartURL:     startURL,
-		CrawledAt:    time.Now(),
+	if len(config.Diff) > 0 {
+		runIDs, err := storage.ResolveRunIDs(db, config.Diff)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := printDiff(db, os.Stdout, runIDs[0], runIDs[1], config.CSVOutput); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	return db.Create(&stats).Error
-}
-
-// ============================================================================
-// HTTP REQUEST
-// ============================================================================
-
-func randomUserAgent() string {
-	return userAgents[rand.Intn(len(userAgents))]
-}
-
-func makeRequest(url string) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	if config.Export != "" {
+		runID, err := latestRunID(db)
+		if config.RunID != "" {
+			runID, err = storage.ResolveRunID(db, config.RunID)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := exportRun(db, runID, config.Export, config.ExportOut, config.ExportLinks, config.ExportDuplicates); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Error("failed to create request", "error", err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if config.ReportOnly && len(config.CompareRuns) > 0 {
+		runIDs, err := storage.ResolveRunIDs(db, config.CompareRuns)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := printComparison(db, os.Stdout, runIDs, config.CSVOutput); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-
-	req.Header.Set("User-Agent", randomUserAgent())
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if config.ReportOnly {
+		if config.RunID == "" {
+			config.RunID, err = latestRunID(db)
+		} else {
+			config.RunID, err = storage.ResolveRunID(db, config.RunID)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runReports(db, os.Stdout, config.Reports, config.RunID); err != nil {
+			log.Fatal(err)
+		}
+		if config.HTMLReport != "" {
+			if err := writeHTMLReport(db, config.HTMLReport, config.RunID); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Wrote HTML report to %s", config.HTMLReport)
+		}
+		return
 	}
-
-	return resp, nil
-}
-
-func makeRequestWithContext(ctx context.Context, url string) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	if config.RunID == "" {
+		config.RunID = crawler.DefaultRunID()
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if config.Quiet {
+		slog.SetLogLoggerLevel(slog.LevelWarn)
 	}
 
-	req.Header.Set("User-Agent", randomUserAgent())
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if config.DebugRuntime > 0 {
+		go logRuntimeStats(config.DebugRuntime)
 	}
 
-	return resp, nil
-}
-
-// ============================================================================
-// URL EXTRACTION
-// ============================================================================
-
-func discoverURLs(seedURL string, worklist chan<- string, maxURLs int, done chan<- bool) {
-	visited := make(map[string]bool)
-	var mu sync.Mutex
-	count := 0
-
-	var crawl func(string)
-	crawl = func(url string) {
-		mu.Lock()
-		if visited[url] || count >= maxURLs {
-			mu.Unlock()
-			return
-		}
-		visited[url] = true
-		count++
-		current := count
-		mu.Unlock()
-
-		resp, err := makeRequest(url)
-		if err != nil {
-			return
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return
-		}
-
-		worklist <- url // Add to worklist for scraping
+	var srv *http.Server
+	if config.Listen != "" {
+		srv = startServer(config.Listen)
+	}
+	health.Set(healthActive)
 
-		links := extractLinks(resp.Body, url)
-		for _, link := range links {
-			if current < maxURLs {
-				go crawl(link)
-			}
-		}
+	names := config.Reports
+	if (config.Classify || len(config.PageTypeRules) > 0) && !slices.Contains(names, "page-types") {
+		names = append(names, "page-types")
 	}
 
+	// The first SIGINT/SIGTERM cancels the crawl: in-flight requests are
+	// aborted, fetched pages and stats are saved. A second one kills the
+	// process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	go func() {
-		crawl(seedURL)
-		time.Sleep(5 * time.Second) // Wait for goroutines to finish
-		done <- true
+		<-ctx.Done()
+		stop()
 	}()
-}
 
-func extractLinks(body io.Reader, baseURL string) []string {
-	var links []string
-	base, _ := url.Parse(baseURL)
+	runIDs := []string{config.RunID}
+	if len(config.Compare) > 0 {
+		runIDs, err = crawlForComparison(ctx, db)
+	} else {
+		c := crawler.New(config.Config, storage.New(db), nil)
+		active.Store(c)
+		_, err = c.Crawl(ctx)
+	}
+	interrupted := errors.Is(err, context.Canceled)
+	if err != nil && !interrupted {
+		log.Fatal(err)
+	}
+	stop()
 
-	tokenizer := html.NewTokenizer(body)
-	for {
-		tt := tokenizer.Next()
-		if tt == html.ErrorToken {
-			break
+	for _, runID := range runIDs {
+		if err := runReports(db, os.Stdout, names, runID); err != nil {
+			log.Print(err)
 		}
-
-		token := tokenizer.Token()
-		if tt == html.StartTagToken && token.Data == "a" {
-			for _, attr := range token.Attr {
-				if attr.Key == "href" {
-					link, err := base.Parse(attr.Val)
-					if err == nil {
-						links = append(links, link.String())
-					}
-				}
+		if config.HTMLReport != "" {
+			path := htmlReportPath(config.HTMLReport, runID, len(runIDs))
+			if err := writeHTMLReport(db, path, runID); err != nil {
+				log.Print(err)
+			} else {
+				log.Printf("Wrote HTML report to %s", path)
 			}
 		}
 	}
-	return links
-}
-
-// ============================================================================
-// SCRAPING
-// ============================================================================
-
-func scrapeURLFromWorklist(url string, parser Parser, db *gorm.DB) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	resp, err := makeRequestWithContext(ctx, url)
-	if err != nil {
-		failedPages.Add(1)
-		return fmt.Errorf("request failed: %w", err)
+	if len(config.Compare) > 0 {
+		fmt.Println()
+		if err := printComparison(db, os.Stdout, runIDs, config.CSVOutput); err != nil {
+			log.Print(err)
+		}
 	}
-	defer resp.Body.Close()
 
-	data, err := parser.GetSEOData(resp)
-	if err != nil {
-		failedPages.Add(1)
-		return fmt.Errorf("parse failed: %w", err)
+	if _, p := activeProgress(); p.Success == 0 && p.Failed > 0 {
+		health.Fail(fmt.Errorf("all %d pages failed", p.Failed))
+	} else {
+		health.Set(healthIdle)
 	}
-
-	if err := savePage(db, data); err != nil {
-		failedPages.Add(1)
-		return fmt.Errorf("db insert failed: %w", err)
+	if interrupted {
+		os.Exit(130)
 	}
-
-	successPages.Add(1)
-	completedPages.Add(1)
-	return nil
-}
-
-func worker(worklist <-chan string, parser Parser, db *gorm.DB, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for url := range worklist {
-		if err := scrapeURLFromWorklist(url, parser, db); err != nil {
-			log.Printf("failed to scrape %s: %v", url, err)
-		}
+	if srv != nil {
+		serveUntilSignal(srv)
 	}
 }
-
-// ============================================================================
-// MAIN
-// ============================================================================
-
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	startTime := time.Now()
-
-	// Initialize DB
-	db, err := initDB()
-	if err != nil {
-		log.Fatal("failed to connect database:", err)
-	}
-
-	// Setup parser
-	parser := &DefaultParser{}
-
-	// Setup worklist channel
-	worklist := make(chan string, 100)
-	done := make(chan bool)
-
-	// Start workers
-	var wg sync.WaitGroup
-	numWorkers := 5
-
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go worker(worklist, parser, db, &wg)
-	}
-
-	// Discover & feed URLs
-	seedURL := "http://books.toscrape.com"
-	maxURLs := 100
-
-	go discoverURLs(seedURL, worklist, maxURLs, done)
-
-	// Wait for discovery to finish
-	<-done
-	close(worklist)
-	wg.Wait()
-
-	// Save stats
-	duration := time.Since(startTime)
-	saveCrawlStats(db, seedURL, duration, int(completedPages.Load()), 
-		int(successPages.Load()), int(failedPages.Load()))
-
-	log.Printf("Scraping complete! Success: %d, Failed: %d, Duration: %v",
-		successPages.Load(), failedPages.Load(), duration)
-}
\ No newline at end of file
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// IN-PAGE ANCHORS
+// ============================================================================
+
+// AnchorRef is an in-page link (href="#section") and whether its
+// target ID is missing from the page.
+type AnchorRef struct {
+	Fragment string
+	Text     string
+	Missing  bool
+}
+
+// anchorFragment returns the target of an anchor-only href. A bare "#"
+// only scrolls to the top and is not an anchor link.
+func anchorFragment(href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if !strings.HasPrefix(href, "#") || len(href) == 1 {
+		return "", false
+	}
+	fragment := href[1:]
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	return fragment, true
+}
+
+// collectAnchorTargets adds the IDs n can be linked to: its id and, for
+// <a>, the legacy name attribute.
+func collectAnchorTargets(n *html.Node, ids map[string]bool) {
+	if id := getAttr(n, "id"); id != "" {
+		ids[id] = true
+	}
+	if n.Data == "a" {
+		if name := getAttr(n, "name"); name != "" {
+			ids[name] = true
+		}
+	}
+}
+
+// resolveAnchors marks anchor links whose target is not on the page and
+// returns how many there are. "#top" always resolves, as in browsers.
+func resolveAnchors(anchors []AnchorRef, ids map[string]bool) int {
+	missing := 0
+	for i, a := range anchors {
+		if ids[a.Fragment] || strings.EqualFold(a.Fragment, "top") {
+			continue
+		}
+		anchors[i].Missing = true
+		missing++
+	}
+	return missing
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// COOKIES
+// ============================================================================
+
+// setCookieNames returns the names of the cookies set by a response and
+// by every redirect leading to it, in order of first appearance. Values
+// are never kept. Unless -cookies gives the client a cookie jar, every
+// page is seen as a first visit without consent.
+func setCookieNames(resp *http.Response) []string {
+	var names []string
+	for r := resp; r != nil; {
+		for _, c := range r.Cookies() {
+			if !slices.Contains(names, c.Name) {
+				names = append(names, c.Name)
+			}
+		}
+		if r.Request == nil {
+			break
+		}
+		r = r.Request.Response
+	}
+	return names
+}
+
+// Matches document.cookie assignments, not reads or comparisons.
+var jsCookieWrite = regexp.MustCompile(`document\s*\.\s*cookie\s*=[^=]`)
+
+// scriptSetsCookie reports whether an inline script assigns
+// document.cookie. It is a heuristic: cookies set by external scripts or
+// through other APIs are not detected.
+func scriptSetsCookie(n *html.Node) bool {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return jsCookieWrite.MatchString(sb.String())
+}
@@ -0,0 +1,43 @@
+package parser
+
+import "golang.org/x/net/html"
+
+// ============================================================================
+// HEADINGS
+// ============================================================================
+
+// HeadingRef is one h1-h6 element of a page.
+type HeadingRef struct {
+	Level int
+	Text  string
+}
+
+// addHeading records an h1-h6 element with its full text, inline
+// elements included, keeping the first h1 as the page's H1.
+func addHeading(data *SEOData, n *html.Node) {
+	level := int(n.Data[1] - '0')
+	text := nodeText(n)
+	data.Outline = append(data.Outline, HeadingRef{Level: level, Text: text})
+	data.Headings++
+	if level == 1 {
+		data.H1Count++
+		if data.H1Count == 1 {
+			data.H1 = text
+		}
+	}
+}
+
+// H1Issue flags successful pages without an h1 ("missing") or with more
+// than one ("multiple").
+func H1Issue(data SEOData) string {
+	if data.StatusCode < 200 || data.StatusCode > 299 {
+		return ""
+	}
+	switch {
+	case data.H1Count == 0:
+		return "missing"
+	case data.H1Count > 1:
+		return "multiple"
+	}
+	return ""
+}
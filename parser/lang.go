@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ============================================================================
+// LANGUAGE DETECTION
+// ============================================================================
+
+// Frequent function words per language. They make up a large share of any
+// running text, so counting them tells Latin-script languages apart well
+// enough to catch a wrong lang attribute, with no model to ship.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "for", "it", "with", "as", "was", "on", "are", "this", "you", "be", "at", "by", "not"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "zu", "den", "mit", "sich", "des", "auf", "für", "ein", "eine", "dem", "auch", "es", "von", "wir"},
+	"fr": {"le", "la", "les", "et", "des", "est", "un", "une", "du", "que", "pour", "dans", "qui", "pas", "sur", "au", "avec", "ce", "sont", "nous"},
+	"es": {"el", "la", "los", "las", "y", "que", "del", "en", "un", "una", "por", "con", "para", "es", "se", "no", "su", "al", "como", "más"},
+	"it": {"il", "di", "che", "la", "e", "per", "un", "una", "non", "sono", "con", "del", "della", "gli", "le", "da", "si", "è", "come", "anche"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "niet", "met", "voor", "ook", "aan", "er", "maar", "om", "wij", "ze"},
+	"pt": {"o", "os", "as", "que", "do", "da", "em", "um", "uma", "para", "com", "não", "por", "mais", "dos", "das", "se", "na", "no", "é"},
+	"sv": {"och", "att", "det", "som", "en", "på", "är", "av", "för", "med", "till", "den", "har", "inte", "om", "ett", "vi", "var", "jag", "kan"},
+	"pl": {"i", "w", "na", "się", "nie", "z", "do", "to", "że", "jest", "jak", "co", "ale", "po", "od", "dla", "o", "przez", "są", "tak"},
+}
+
+var stopwordLanguages = func() map[string][]string {
+	m := make(map[string][]string)
+	for lang, words := range languageStopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// Detection needs this many words, and the best language must be ahead
+// of the runner-up by this factor, or the text is left undetected.
+const (
+	minDetectWords  = 50
+	minDetectMargin = 1.5
+)
+
+// detectLanguage guesses the language of visible text as a two-letter
+// code, or returns "" when the text is too short or too ambiguous.
+func detectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) < minDetectWords {
+		return ""
+	}
+
+	scores := make(map[string]int)
+	for _, w := range words {
+		for _, lang := range stopwordLanguages[w] {
+			scores[lang]++
+		}
+	}
+
+	var best, second string
+	for lang, score := range scores {
+		switch {
+		case best == "" || score > scores[best] || score == scores[best] && lang < best:
+			best, second = lang, best
+		case second == "" || score > scores[second] || score == scores[second] && lang < second:
+			second = lang
+		}
+	}
+	if best == "" || scores[best]*20 < len(words) {
+		return "" // under 5% stopwords: not a language we know
+	}
+	if second != "" && float64(scores[best]) < float64(scores[second])*minDetectMargin {
+		return ""
+	}
+	return best
+}
+
+// primaryLanguage returns the primary subtag of a lang attribute,
+// lowercased: "en-US" becomes "en".
+func primaryLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// LangMismatch reports whether a page declares a language and its text
+// was detected as a different one.
+func LangMismatch(data SEOData) bool {
+	declared := primaryLanguage(data.Lang)
+	return declared != "" && data.DetectedLang != "" && declared != data.DetectedLang
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// URL EXTRACTION
+// ============================================================================
+
+// Link is a link found on a page: its normalized target, rel and anchor
+// text (or the alt of a linked image).
+type Link struct {
+	URL  string
+	Rel  string
+	Text string
+}
+
+// ExtractLinks returns the http and https targets of <a href> links,
+// plus <link href> elements whose rel is one of allowRels, normalized
+// with n. The page's robots meta directives are added to directives.
+func ExtractLinks(body io.Reader, baseURL string, allowRels []string, n Normalizer, directives *SEOData) []Link {
+	var links []Link
+	base, _ := url.Parse(baseURL)
+
+	// Index of the <a> link whose text is being collected, or -1.
+	open := -1
+	var text strings.Builder
+	closeAnchor := func() {
+		if open >= 0 {
+			links[open].Text = CollapseSpace(text.String())
+			open = -1
+		}
+		text.Reset()
+	}
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if open >= 0 {
+			switch {
+			case tt == html.TextToken:
+				text.WriteString(token.Data)
+			case tt == html.EndTagToken && token.Data == "a":
+				closeAnchor()
+			case token.Data == "img":
+				for _, attr := range token.Attr {
+					if attr.Key == "alt" {
+						text.WriteByte(' ')
+						text.WriteString(attr.Val)
+						text.WriteByte(' ')
+					}
+				}
+			case !isInlineElement(token.Data):
+				text.WriteByte(' ')
+			}
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		if token.Data == "a" {
+			closeAnchor()
+		}
+		if token.Data == "meta" {
+			var name, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "name":
+					name = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			if name == "robots" || name == "googlebot" {
+				addRobotsDirectives(directives, content)
+			}
+			continue
+		}
+		if token.Data != "a" && token.Data != "link" {
+			continue
+		}
+
+		var href, rel string
+		for _, attr := range token.Attr {
+			switch attr.Key {
+			case "href":
+				href = attr.Val
+			case "rel":
+				rel = attr.Val
+			}
+		}
+		if href == "" || (token.Data == "link" && !HasAnyToken(rel, allowRels)) {
+			continue
+		}
+
+		// javascript:, mailto: and other links that aren't pages are
+		// skipped.
+		link, err := base.Parse(n.CleanHref(href))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			continue
+		}
+		if normalized, err := n.Normalize(link.String()); err == nil {
+			links = append(links, Link{URL: normalized, Rel: rel})
+			if token.Data == "a" && tt == html.StartTagToken {
+				open = len(links) - 1
+			}
+		}
+	}
+	closeAnchor()
+	return links
+}
@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinksHrefs(t *testing.T) {
+	body := `<html><body>
+<a href="  /a?x=1&amp;y=2 ">entity</a>
+<a href="/b#section">fragment</a>
+<a href="#top">same page</a>
+<a href="javascript:void(0)">js</a>
+<a href="JavaScript:alert(1)">mixed-case js</a>
+<a href="mailto:someone@example.com">mail</a>
+<a href="HTTPS://Example.com/C">mixed-case scheme</a>
+<a href="/d
+/e">newline</a>
+</body></html>`
+
+	n := Normalizer{Paths: true, Encoding: true}
+	var got []string
+	for _, link := range ExtractLinks(strings.NewReader(body), "http://example.com/page", nil, n, &SEOData{}) {
+		got = append(got, link.URL)
+	}
+	want := []string{
+		"http://example.com/a?x=1&y=2",
+		"http://example.com/b",
+		"http://example.com/page",
+		"https://example.com/C",
+		"http://example.com/d/e",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExtractLinks = %q, want %q", got, want)
+	}
+}
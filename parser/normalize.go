@@ -0,0 +1,264 @@
+package parser
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ============================================================================
+// URL NORMALIZATION
+// ============================================================================
+
+// Query parameters that only track where a visitor came from, dropped by
+// Normalizer.Query along with its StripParams.
+var trackingParams = []string{"gclid", "dclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid", "_ga", "_gl"}
+
+// A Normalizer returns the form of URLs used for deduplication. Each
+// field turns on a rule of the -normalize-* and -fold-* flags; the zero
+// value applies none of them.
+type Normalizer struct {
+	Paths       bool     // resolve dot segments, collapse duplicate slashes
+	Encoding    bool     // canonical percent-encoding, see normalizeEncoding
+	Query       bool     // drop tracking parameters, sort the rest
+	StripParams []string // more parameters dropped along with Query
+
+	// Opt-in rules merging URLs that usually, but not always, serve the
+	// same page.
+	FoldScheme        bool // treat http as https
+	FoldTrailingSlash bool // drop the trailing slash of every path but the root
+}
+
+// Normalize returns the form of rawURL used for deduplication: the
+// fragment is dropped, scheme and host are lowercased, the scheme's
+// default port is removed, an empty path becomes "/" and, with Paths,
+// dot segments are resolved and duplicate slashes collapsed
+// (http://x//a/./b/../c becomes http://x/a/c). With Encoding,
+// percent-encoding in the path and query is made canonical too, see
+// normalizeEncoding, and with Query, tracking parameters are dropped and
+// the rest sorted, see normalizeQuery.
+func (n Normalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(n.CleanHref(rawURL))
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]" // IPv6 literal
+		}
+	}
+	if n.FoldScheme && u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	if u.Path == "" && u.Host != "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+
+	if u.Opaque == "" && (n.Paths || n.Encoding) {
+		p := u.EscapedPath()
+		if n.Encoding {
+			p = normalizeEncoding(p, "/:@!$&'()*+,;=")
+		}
+		if n.Paths {
+			p = removeDotSegments(collapseSlashes(p))
+		}
+		if unescaped, err := url.PathUnescape(p); err == nil {
+			u.Path = unescaped
+			u.RawPath = p
+		}
+	}
+	if n.FoldTrailingSlash && u.Opaque == "" && len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.RawPath != "" {
+			u.RawPath = strings.TrimRight(u.RawPath, "/")
+		}
+		if u.Path == "" {
+			u.Path, u.RawPath = "/", ""
+		}
+	}
+	if n.Encoding {
+		u.RawQuery = normalizeEncoding(u.RawQuery, "/?:@!$&'()*+,;=")
+	}
+	if n.Query {
+		u.RawQuery = n.normalizeQuery(u.RawQuery)
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
+
+// normalizeQuery drops utm_* and other tracking parameters (and those
+// in StripParams) from an escaped query and sorts the rest by
+// name, keeping the order of repeated names. The parameters are not
+// re-encoded, so a=b%2Fc stays as it is.
+func (n Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "utm_") || slices.Contains(trackingParams, name) ||
+			slices.Contains(n.StripParams, name) {
+			continue
+		}
+		params = append(params, param)
+	}
+	slices.SortStableFunc(params, func(a, b string) int {
+		na, _, _ := strings.Cut(a, "=")
+		nb, _, _ := strings.Cut(b, "=")
+		return strings.Compare(na, nb)
+	})
+	return strings.Join(params, "&")
+}
+
+// CleanHref repairs an href the way browsers read it before it is
+// parsed: surrounding whitespace is trimmed, embedded tabs and newlines
+// are removed and, with Encoding, a % that doesn't start an escape
+// becomes %25 instead of failing the parse.
+func (n Normalizer) CleanHref(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if strings.ContainsAny(rawURL, "\t\r\n") {
+		rawURL = strings.NewReplacer("\t", "", "\r", "", "\n", "").Replace(rawURL)
+	}
+	if !n.Encoding || !strings.Contains(rawURL, "%") {
+		return rawURL
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(rawURL); i++ {
+		sb.WriteByte(rawURL[i])
+		if rawURL[i] == '%' && (i+2 >= len(rawURL) || !isHex(rawURL[i+1]) || !isHex(rawURL[i+2])) {
+			sb.WriteString("25")
+		}
+	}
+	return sb.String()
+}
+
+// normalizeEncoding rewrites an escaped path or query into one canonical
+// form (RFC 3986 section 6.2.2): escapes of unreserved characters are
+// decoded (%7E becomes ~), every other escape gets uppercase hex (%2f
+// becomes %2F), and characters that must not appear raw, such as spaces
+// and non-ASCII, are percent-encoded as UTF-8. Characters in keep, the
+// delimiters allowed raw in this component, are left alone, so an encoded
+// %2F stays distinct from a literal /. A stray % is encoded as %25.
+func normalizeEncoding(s, keep string) string {
+	const hex = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(b) {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('%')
+				sb.WriteByte(hex[b>>4])
+				sb.WriteByte(hex[b&15])
+			}
+			i += 2
+		case isUnreserved(c) || strings.IndexByte(keep, c) >= 0:
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&15])
+		}
+	}
+	return sb.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func collapseSlashes(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	return p
+}
+
+// removeDotSegments implements RFC 3986 section 5.2.4.
+func removeDotSegments(p string) string {
+	if p == "" {
+		return p
+	}
+
+	var out []string
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(p, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// Same compares two URLs after normalization.
+func (n Normalizer) Same(a, b string) bool {
+	na, errA := n.Normalize(a)
+	nb, errB := n.Normalize(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return na == nb
+}
+
+// OrRaw returns rawURL normalized, or unchanged if it doesn't parse.
+func (n Normalizer) OrRaw(rawURL string) string {
+	if normalized, err := n.Normalize(rawURL); err == nil {
+		return normalized
+	}
+	return rawURL
+}
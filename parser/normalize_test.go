@@ -0,0 +1,122 @@
+package parser
+
+import "testing"
+
+func TestNormalizePaths(t *testing.T) {
+	n := Normalizer{Paths: true}
+	tests := []struct {
+		in, want string
+	}{
+		{"http://x//a/./b/../c", "http://x/a/c"},
+		{"http://x/a/b/../../c", "http://x/c"},
+		{"http://x/../../a", "http://x/a"},
+		{"http://x/a/./", "http://x/a/"},
+		{"http://x/a/.", "http://x/a/"},
+		{"http://x/a/b/..", "http://x/a/"},
+		{"http://x/a//b///c", "http://x/a/b/c"},
+		{"http://x///", "http://x/"},
+		{"http://x/a/..b/c", "http://x/a/..b/c"},
+		{"http://x/a/.b", "http://x/a/.b"},
+		{"http://x//a?q=//b", "http://x/a?q=//b"},
+		{"HTTP://X:80/a/../b", "http://x/b"},
+		{"https://x:443", "https://x/"},
+	}
+	for _, tt := range tests {
+		got, err := n.Normalize(tt.in)
+		if err != nil {
+			t.Errorf("Normalize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePathsOff(t *testing.T) {
+	var n Normalizer
+	in := "http://x//a/./b/../c"
+	got, err := n.Normalize(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != in {
+		t.Errorf("Normalize(%q) without Paths = %q, want it unchanged", in, got)
+	}
+}
+
+func TestNormalizeEncoding(t *testing.T) {
+	const pathKeep = "/:@!$&'()*+,;="
+	tests := []struct {
+		in, want string
+	}{
+		{"/a%7Eb", "/a~b"},
+		{"/%41%62%2d%5F%2e", "/Ab-_."},
+		{"/a%2fb", "/a%2Fb"},
+		{"/a%2Fb/c", "/a%2Fb/c"},
+		{"/a b", "/a%20b"},
+		{"/a%20b", "/a%20b"},
+		{"/café", "/caf%C3%A9"},
+		{"/caf%c3%a9", "/caf%C3%A9"},
+		{"/100%", "/100%25"},
+		{"/a%zz", "/a%25zz"},
+		{"/a;b=c,d", "/a;b=c,d"},
+		{"/a\"b<c>", "/a%22b%3Cc%3E"},
+	}
+	for _, tt := range tests {
+		if got := normalizeEncoding(tt.in, pathKeep); got != tt.want {
+			t.Errorf("normalizeEncoding(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCleanHref(t *testing.T) {
+	tests := []struct {
+		in       string
+		encoding bool
+		want     string
+	}{
+		{"  /a  ", false, "/a"},
+		{"\n\t/a/b\r\n", false, "/a/b"},
+		{"/a\n/b\t/c", false, "/a/b/c"},
+		{"/a b", false, "/a b"},
+		{"/100%", false, "/100%"},
+		{"/100%", true, "/100%25"},
+		{"/a%2", true, "/a%252"},
+		{"/a%2Fb%zz", true, "/a%2Fb%25zz"},
+		{"/a#frag", true, "/a#frag"},
+		{" javascript:void(0) ", true, "javascript:void(0)"},
+	}
+	for _, tt := range tests {
+		n := Normalizer{Encoding: tt.encoding}
+		if got := n.CleanHref(tt.in); got != tt.want {
+			t.Errorf("CleanHref(%q) with Encoding=%v = %q, want %q", tt.in, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMessyHrefs(t *testing.T) {
+	n := Normalizer{Paths: true, Encoding: true}
+	tests := []struct {
+		in, want string
+	}{
+		{" http://x/a b/\n", "http://x/a%20b/"},
+		{"HTTP://Example.COM/A", "http://example.com/A"},
+		{"HtTpS://x/a#section-2", "https://x/a"},
+		{"http://x/%7euser/%e2%82%ac", "http://x/~user/%E2%82%AC"},
+		{"http://x/café?q=a b", "http://x/caf%C3%A9?q=a%20b"},
+		{"http://x/a%2fb", "http://x/a%2Fb"},
+		{"http://x/100%", "http://x/100%25"},
+		{"http://x/?a=1&b=%2f", "http://x/?a=1&b=%2F"},
+	}
+	for _, tt := range tests {
+		got, err := n.Normalize(tt.in)
+		if err != nil {
+			t.Errorf("Normalize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Package parser extracts the SEO data of a crawled page from its HTTP
+// response, and holds the HTML and URL helpers shared by the crawler
+// and its reports.
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// SEO DATA & PARSER
+// ============================================================================
+
+type SEOData struct {
+	URL                string
+	Title              string
+	H1                 string
+	MetaDescription    string
+	Meta               map[string]string
+	Lang               string
+	DetectedLang       string
+	StatusCode         int
+	Noindex            bool
+	Nofollow           bool
+	RobotsDirectives   []string
+	FinalURL           string
+	RedirectHops       int
+	RedirectChain      []RedirectHop
+	RedirectLoop       bool
+	Canonical          string
+	OGURL              string
+	OGTitle            string
+	OGDescription      string
+	OGImage            string
+	TwitterCard        string
+	TwitterTitle       string
+	TwitterDescription string
+	TwitterImage       string
+	InlineScripts      int
+	ExternalScripts    int
+	InlineStyles       int
+	Stylesheets        int
+	WordCount          int
+	Headings           int
+	H1Count            int
+	Outline            []HeadingRef // every h1-h6, in document order
+	SetCookies         []string
+	ScriptCookies      bool
+	ThemeColor         string
+	Manifest           string
+	ServiceWorker      bool
+	ContentHash        string
+	TextHash           string
+	ContentType        string
+	ETag               string
+	LastModified       string
+	Truncated          bool
+	Rendered           bool
+	ContentLength      int64
+	BodyBytes          int64
+	LocalIP            string
+	Proxy              string
+	DNSMillis          int64
+	ConnectMillis      int64
+	TLSMillis          int64
+	TTFBMillis         int64
+	TotalMillis        int64
+	Attempts           int
+	Anchors            []AnchorRef
+	BrokenAnchors      int
+	JSONLDTypes        []string
+	StructuredData     []map[string]any
+	LastMod            *time.Time
+	SitemapPriority    *float64
+	Seed               bool
+	ScopeException     bool
+	Depth              int
+	Resources          []ResourceRef
+}
+
+type ResourceRef struct {
+	Kind   string
+	Inline bool
+	URL    string
+	Size   int
+}
+
+// A Parser extracts the SEO data of a page from its response. What the
+// crawler knows about the request itself, such as its timings, attempts
+// and the sitemap entry it came from, is filled in after parsing.
+type Parser interface {
+	GetSEOData(resp *http.Response) (SEOData, error)
+}
+
+// ParserFactory builds the Parser for one worker. Each worker owns its
+// parser, so implementations may keep buffers or other state between pages
+// without locking.
+type ParserFactory func() Parser
+
+type DefaultParser struct {
+	ListResources bool     // keep every script/stylesheet, not just the counts
+	MetaWatchlist []string // lowercased <meta> names to keep, see -meta
+	RobotsUA      string   // X-Robots-Tag values scoped to this agent apply, see -robots-ua
+}
+
+// NewDefaultParserFactory returns a factory for copies of p. They hold no
+// per-page state, so this is the trivial case.
+func NewDefaultParserFactory(p DefaultParser) ParserFactory {
+	return func() Parser {
+		p := p
+		return &p
+	}
+}
+
+func (p *DefaultParser) GetSEOData(resp *http.Response) (SEOData, error) {
+	data := SEOData{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+	}
+	if source, hops := RedirectSource(resp); hops > 0 {
+		data.FinalURL = data.URL
+		data.URL = source
+		data.RedirectHops = hops
+		data.RedirectChain, data.RedirectLoop = RedirectChain(resp)
+	}
+	data.SetCookies = setCookieNames(resp)
+	data.ETag = resp.Header.Get("ETag")
+	data.LastModified = resp.Header.Get("Last-Modified")
+	AddHeaderRobotsDirectives(&data, resp.Header, p.RobotsUA)
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return data, err
+	}
+
+	ids := make(map[string]bool)
+
+	var extract func(*html.Node)
+	extract = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			collectAnchorTargets(n, ids)
+
+			switch n.Data {
+			case "title":
+				if data.Title == "" {
+					data.Title = nodeText(n)
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				addHeading(&data, n)
+			case "meta":
+				var name, content string
+				for _, attr := range n.Attr {
+					if attr.Key == "name" {
+						name = attr.Val
+					}
+					if attr.Key == "content" {
+						content = attr.Val
+					}
+				}
+				p.collectWatchedMeta(&data, n, content)
+				switch strings.ToLower(name) {
+				case "description":
+					data.MetaDescription = CollapseSpace(content)
+				case "theme-color":
+					if data.ThemeColor == "" {
+						data.ThemeColor = strings.TrimSpace(content)
+					}
+				case "robots", "googlebot":
+					addRobotsDirectives(&data, content)
+				}
+				addSocialMeta(&data, resp.Request.URL, n, content)
+			case "a":
+				if fragment, ok := anchorFragment(getAttr(n, "href")); ok {
+					text := nodeText(n)
+					data.Anchors = append(data.Anchors, AnchorRef{Fragment: fragment, Text: text})
+				}
+			case "html":
+				if data.Lang == "" {
+					data.Lang = strings.TrimSpace(getAttr(n, "lang"))
+				}
+			case "body":
+				text := nodeText(n)
+				data.WordCount = CountWords(text)
+				data.TextHash = ContentHash([]byte(text))
+				data.DetectedLang = detectLanguage(text)
+			case "script":
+				if strings.EqualFold(strings.TrimSpace(getAttr(n, "type")), "application/ld+json") {
+					addJSONLD(&data, n)
+				}
+				if registersServiceWorker(n) {
+					data.ServiceWorker = true
+				}
+				if src := getAttr(n, "src"); src != "" {
+					data.ExternalScripts++
+					p.addResource(&data, resp.Request.URL, "script", src)
+				} else if size := inlineSize(n); size > 0 {
+					data.InlineScripts++
+					p.addInlineResource(&data, "script", size)
+					if scriptSetsCookie(n) {
+						data.ScriptCookies = true
+					}
+				}
+			case "style":
+				if size := inlineSize(n); size > 0 {
+					data.InlineStyles++
+					p.addInlineResource(&data, "stylesheet", size)
+				}
+			case "link":
+				if HasToken(getAttr(n, "rel"), "canonical") && data.Canonical == "" {
+					data.Canonical = resolveRef(resp.Request.URL, getAttr(n, "href"))
+				}
+				if HasToken(getAttr(n, "rel"), "manifest") && data.Manifest == "" {
+					data.Manifest = resolveRef(resp.Request.URL, getAttr(n, "href"))
+				}
+				if HasToken(getAttr(n, "rel"), "stylesheet") {
+					if href := getAttr(n, "href"); href != "" {
+						data.Stylesheets++
+						p.addResource(&data, resp.Request.URL, "stylesheet", href)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			extract(c)
+		}
+	}
+	extract(doc)
+	data.BrokenAnchors = resolveAnchors(data.Anchors, ids)
+
+	return data, nil
+}
+
+func (p *DefaultParser) addResource(data *SEOData, base *url.URL, kind, ref string) {
+	if !p.ListResources {
+		return
+	}
+	if u, err := base.Parse(ref); err == nil {
+		ref = u.String()
+	}
+	data.Resources = append(data.Resources, ResourceRef{Kind: kind, URL: ref})
+}
+
+func (p *DefaultParser) addInlineResource(data *SEOData, kind string, size int) {
+	if !p.ListResources {
+		return
+	}
+	data.Resources = append(data.Resources, ResourceRef{Kind: kind, Inline: true, Size: size})
+}
+
+// addSocialMeta stores the Open Graph and Twitter Card tags of a <meta>
+// element, keeping the first of each. Open Graph tags are matched on
+// property and Twitter tags on name, falling back to the other attribute
+// as many sites mix them up. Image and og:url values are resolved
+// against base.
+func addSocialMeta(data *SEOData, base *url.URL, n *html.Node, content string) {
+	key := getAttr(n, "property")
+	if key == "" {
+		key = getAttr(n, "name")
+	}
+	content = strings.TrimSpace(content)
+
+	var field *string
+	resolve := false
+	switch strings.ToLower(key) {
+	case "og:url":
+		field, resolve = &data.OGURL, true
+	case "og:title":
+		field = &data.OGTitle
+	case "og:description":
+		field = &data.OGDescription
+	case "og:image", "og:image:url":
+		field, resolve = &data.OGImage, true
+	case "twitter:card":
+		field = &data.TwitterCard
+	case "twitter:title":
+		field = &data.TwitterTitle
+	case "twitter:description":
+		field = &data.TwitterDescription
+	case "twitter:image", "twitter:image:src":
+		field, resolve = &data.TwitterImage, true
+	default:
+		return
+	}
+	if *field != "" || content == "" {
+		return
+	}
+	if resolve {
+		content = resolveRef(base, content)
+	} else {
+		content = CollapseSpace(content)
+	}
+	*field = content
+}
+
+// addRobotsDirectives merges a robots meta content value into data,
+// keeping every directive (noarchive, max-snippet:50, ...) and setting
+// the flags that change crawl behaviour.
+func addRobotsDirectives(data *SEOData, content string) {
+	for _, directive := range strings.Split(content, ",") {
+		directive = strings.ToLower(strings.Join(strings.Fields(directive), ""))
+		if directive == "" || slices.Contains(data.RobotsDirectives, directive) {
+			continue
+		}
+		data.RobotsDirectives = append(data.RobotsDirectives, directive)
+
+		switch directive {
+		case "noindex":
+			data.Noindex = true
+		case "nofollow":
+			data.Nofollow = true
+		case "none":
+			data.Noindex, data.Nofollow = true, true
+		}
+	}
+}
+
+// AddHeaderRobotsDirectives merges the X-Robots-Tag headers of a
+// response into data. Values scoped to another crawler
+// ("otherbot: noindex") are skipped; those for googlebot or robotsUA
+// apply, like the matching meta tags.
+func AddHeaderRobotsDirectives(data *SEOData, header http.Header, robotsUA string) {
+	for _, value := range header.Values("X-Robots-Tag") {
+		agent, rest, ok := strings.Cut(value, ":")
+		if ok && !strings.Contains(agent, ",") {
+			switch agent = strings.ToLower(strings.TrimSpace(agent)); agent {
+			case "max-snippet", "max-image-preview", "max-video-preview", "unavailable_after":
+				// A directive with a value, not a user agent.
+			case "googlebot", strings.ToLower(robotsUA):
+				value = rest
+			default:
+				continue
+			}
+		}
+		addRobotsDirectives(data, value)
+	}
+}
+
+// RedirectSource walks back through the redirects the client followed
+// and returns the originally requested URL and the number of hops.
+func RedirectSource(resp *http.Response) (string, int) {
+	req := resp.Request
+	hops := 0
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+		hops++
+	}
+	return req.URL.String(), hops
+}
+
+// collectWatchedMeta stores the content of a <meta> whose name, property
+// or http-equiv is on the -meta watchlist, keyed by the lowercased watched
+// name. The first tag of each name wins.
+func (p *DefaultParser) collectWatchedMeta(data *SEOData, n *html.Node, content string) {
+	if len(p.MetaWatchlist) == 0 {
+		return
+	}
+	for _, key := range []string{"name", "property", "http-equiv"} {
+		name := strings.ToLower(strings.TrimSpace(getAttr(n, key)))
+		if name == "" || !slices.Contains(p.MetaWatchlist, name) {
+			continue
+		}
+		if data.Meta == nil {
+			data.Meta = make(map[string]string)
+		}
+		if _, ok := data.Meta[name]; !ok {
+			data.Meta[name] = strings.TrimSpace(content)
+		}
+	}
+}
+
+// ContentHash is the SHA-256 of a response body, hex-encoded.
+func ContentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveRef makes a trimmed attribute value absolute against base.
+// Blank values stay blank.
+func resolveRef(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	if u, err := base.Parse(ref); err == nil {
+		return u.String()
+	}
+	return ref
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// HasToken reports whether a space-separated attribute such as rel
+// contains token, ignoring case.
+func HasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyToken reports whether list contains any of tokens, ignoring case.
+func HasAnyToken(list string, tokens []string) bool {
+	for _, token := range tokens {
+		if HasToken(list, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineSize returns the byte length of an element's non-blank text.
+func inlineSize(n *html.Node) int {
+	size := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			size += len(strings.TrimSpace(c.Data))
+		}
+	}
+	return size
+}
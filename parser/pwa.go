@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// PWA METADATA
+// ============================================================================
+
+var (
+	serviceWorkerRegister = regexp.MustCompile(`serviceWorker\s*\.\s*register\s*\(`)
+	serviceWorkerScripts  = map[string]bool{"sw.js": true, "service-worker.js": true, "serviceworker.js": true}
+)
+
+// registersServiceWorker reports whether a <script> looks like it
+// registers a service worker: an inline call to
+// navigator.serviceWorker.register or a script named like sw.js. Workers
+// registered from other external scripts are not detected.
+func registersServiceWorker(n *html.Node) bool {
+	if src := strings.TrimSpace(getAttr(n, "src")); src != "" {
+		if i := strings.IndexAny(src, "?#"); i >= 0 {
+			src = src[:i]
+		}
+		return serviceWorkerScripts[strings.ToLower(path.Base(src))]
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return serviceWorkerRegister.MatchString(sb.String())
+}
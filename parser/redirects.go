@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// REDIRECT CHAINS
+// ============================================================================
+
+// RedirectHop is one response of a redirect chain: the URL requested and
+// the status it answered with. The last hop is the final response.
+type RedirectHop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// RedirectChain returns every hop from the originally requested URL to
+// resp, and whether the chain loops: the final response still redirects,
+// to a URL already in the chain. The chain is nil when there was no
+// redirect.
+func RedirectChain(resp *http.Response) ([]RedirectHop, bool) {
+	if resp.Request.Response == nil {
+		return nil, false
+	}
+
+	chain := []RedirectHop{{URL: resp.Request.URL.String(), Status: resp.StatusCode}}
+	for r := resp.Request.Response; r != nil && r.Request != nil; r = r.Request.Response {
+		chain = append(chain, RedirectHop{URL: r.Request.URL.String(), Status: r.StatusCode})
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	loop := false
+	if next, err := resp.Location(); err == nil {
+		for _, hop := range chain {
+			if hop.URL == next.String() {
+				loop = true
+				break
+			}
+		}
+	}
+	return chain, loop
+}
+
+// RedirectStatuses returns the statuses of a stored chain, e.g.
+// "301 302 200".
+func RedirectStatuses(encoded string) string {
+	var chain []RedirectHop
+	if err := json.Unmarshal([]byte(encoded), &chain); err != nil {
+		return ""
+	}
+	statuses := make([]string, len(chain))
+	for i, hop := range chain {
+		statuses[i] = strconv.Itoa(hop.Status)
+	}
+	return strings.Join(statuses, " ")
+}
+
+func EncodeRedirectChain(chain []RedirectHop) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(chain)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
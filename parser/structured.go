@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// STRUCTURED DATA & PAGE TYPES
+// ============================================================================
+
+// parseJSONLD decodes a <script type="application/ld+json"> block into
+// its items: a single object, an array of objects, or the entries of an
+// @graph. Invalid JSON yields nothing.
+func parseJSONLD(raw string) []map[string]any {
+	var doc any
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil
+	}
+
+	var items []map[string]any
+	var collect func(any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]any:
+			if graph, ok := v["@graph"]; ok {
+				collect(graph)
+				return
+			}
+			items = append(items, v)
+		}
+	}
+	collect(doc)
+	return items
+}
+
+// jsonLDTypes returns the @type values of an item, which may be a string
+// or a list of strings.
+func jsonLDTypes(item map[string]any) []string {
+	switch t := item["@type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func addJSONLD(data *SEOData, n *html.Node) {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+
+	for _, item := range parseJSONLD(sb.String()) {
+		data.StructuredData = append(data.StructuredData, item)
+		for _, t := range jsonLDTypes(item) {
+			if !slices.Contains(data.JSONLDTypes, t) {
+				data.JSONLDTypes = append(data.JSONLDTypes, t)
+			}
+		}
+	}
+}
+
+// A PageTypeRule assigns Type to pages whose URL matches Pattern.
+type PageTypeRule struct {
+	Type    string
+	Pattern *regexp.Regexp
+}
+
+// ParsePageTypeRule parses a -page-type value such as "product=/p/[0-9]+".
+func ParsePageTypeRule(v string) (PageTypeRule, error) {
+	name, pattern, ok := strings.Cut(v, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || pattern == "" {
+		return PageTypeRule{}, fmt.Errorf("want type=regexp, got %q", v)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return PageTypeRule{}, err
+	}
+	return PageTypeRule{Type: name, Pattern: re}, nil
+}
+
+// Page types implied by common schema.org types.
+var jsonLDPageTypes = map[string]string{
+	"Product":        "product",
+	"ProductGroup":   "product",
+	"Article":        "article",
+	"NewsArticle":    "article",
+	"BlogPosting":    "article",
+	"TechArticle":    "article",
+	"CollectionPage": "category",
+	"ItemList":       "category",
+	"FAQPage":        "faq",
+	"Recipe":         "recipe",
+	"Event":          "event",
+	"JobPosting":     "job",
+	"ContactPage":    "contact",
+	"AboutPage":      "about",
+}
+
+// ClassifyPage returns the page type: the first matching rule, otherwise
+// the type implied by the page's JSON-LD, otherwise "other".
+func ClassifyPage(data SEOData, rules []PageTypeRule) string {
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(data.URL) {
+			return rule.Type
+		}
+	}
+	for _, t := range data.JSONLDTypes {
+		if pageType, ok := jsonLDPageTypes[t]; ok {
+			return pageType
+		}
+	}
+	return "other"
+}
+
+// Required fields per schema.org type, after Google's rich result
+// requirements. "a|b" means either field will do and a dotted path looks
+// into nested objects (and every element of nested arrays). Extended or
+// overridden with -structured-data-rules.
+var defaultStructuredDataRules = map[string][]string{
+	"Product":        {"name", "offers|review|aggregateRating"},
+	"Offer":          {"price|priceSpecification"},
+	"Article":        {"headline"},
+	"NewsArticle":    {"headline"},
+	"BlogPosting":    {"headline"},
+	"Recipe":         {"name", "image"},
+	"Event":          {"name", "startDate", "location"},
+	"JobPosting":     {"title", "description", "datePosted", "hiringOrganization"},
+	"FAQPage":        {"mainEntity"},
+	"BreadcrumbList": {"itemListElement"},
+	"LocalBusiness":  {"name", "address"},
+	"Review":         {"itemReviewed", "author", "reviewRating"},
+	"VideoObject":    {"name", "thumbnailUrl", "uploadDate"},
+}
+
+// LoadStructuredDataRules returns the default rules merged with the
+// JSON file at path (-structured-data-rules), whose entries replace the
+// default for their type. An empty path yields the defaults.
+func LoadStructuredDataRules(path string) (map[string][]string, error) {
+	rules := make(map[string][]string, len(defaultStructuredDataRules))
+	for t, fields := range defaultStructuredDataRules {
+		rules[t] = fields
+	}
+	if path == "" {
+		return rules, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var custom map[string][]string
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for t, fields := range custom {
+		rules[t] = fields
+	}
+	return rules, nil
+}
+
+// MissingStructuredData checks every structured data item of a known
+// type, including typed objects nested in other items (the Offer of a
+// Product), and returns the missing fields as Type.field.
+func MissingStructuredData(items []map[string]any, rules map[string][]string) []string {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var missing []string
+	var check func(v any)
+	check = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, elem := range v {
+				check(elem)
+			}
+		case map[string]any:
+			for _, t := range jsonLDTypes(v) {
+				for _, field := range rules[t] {
+					if hasAnyField(v, field) {
+						continue
+					}
+					entry := t + "." + field
+					if !slices.Contains(missing, entry) {
+						missing = append(missing, entry)
+					}
+				}
+			}
+			for _, nested := range v {
+				check(nested)
+			}
+		}
+	}
+	for _, item := range items {
+		check(item)
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+func hasAnyField(item map[string]any, alternatives string) bool {
+	for _, path := range strings.Split(alternatives, "|") {
+		if hasField(item, strings.Split(strings.TrimSpace(path), ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasField reports whether the path leads to a non-empty value.
+func hasField(v any, path []string) bool {
+	switch v := v.(type) {
+	case []any:
+		for _, elem := range v {
+			if hasField(elem, path) {
+				return true
+			}
+		}
+		return false
+	case map[string]any:
+		if len(path) == 0 {
+			return len(v) > 0
+		}
+		next, ok := v[path[0]]
+		return ok && hasField(next, path[1:])
+	case string:
+		return len(path) == 0 && strings.TrimSpace(v) != ""
+	case nil:
+		return false
+	default:
+		return len(path) == 0
+	}
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ============================================================================
+// TEXT EXTRACTION
+// ============================================================================
+
+// VisibleText returns the whitespace-collapsed text of an HTML document,
+// skipping script, style and other non-rendered elements.
+func VisibleText(body io.Reader) string {
+	var sb strings.Builder
+	skip := 0
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tt := tokenizer.Next()
+		switch tt {
+		case html.ErrorToken:
+			return CollapseSpace(sb.String())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			if isHiddenTextElement(string(name)) && tt != html.SelfClosingTagToken {
+				if tt == html.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			}
+			if !isInlineElement(string(name)) {
+				sb.WriteByte(' ')
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+// CollapseSpace trims s and collapses every run of whitespace, non-breaking
+// spaces included, into a single space.
+func CollapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isHiddenTextElement(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// inlineElements are the elements rendered inside the surrounding text,
+// so "Hel<b>lo</b>" reads as one word. Any other element, <br> included,
+// separates the text before and after it.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true,
+	"code": true, "data": true, "del": true, "dfn": true, "em": true, "font": true,
+	"i": true, "ins": true, "kbd": true, "label": true, "mark": true, "q": true,
+	"s": true, "samp": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "time": true, "tt": true, "u": true, "var": true,
+	"wbr": true,
+}
+
+func isInlineElement(name string) bool {
+	return inlineElements[name]
+}
+
+// nodeText returns the whitespace-collapsed text below n, nested markup
+// included, skipping the same non-rendered elements as VisibleText.
+// Entities are already decoded by the parser.
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if isHiddenTextElement(n.Data) {
+				return
+			}
+			if !isInlineElement(n.Data) {
+				sb.WriteByte(' ')
+				defer sb.WriteByte(' ')
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return CollapseSpace(sb.String())
+}
+
+func CountWords(text string) int {
+	return len(strings.Fields(text))
+}
@@ -0,0 +1,1285 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"crawl-guardian.com/fetch"
+	"crawl-guardian.com/parser"
+	"crawl-guardian.com/storage"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// REPORTS
+// ============================================================================
+
+// Reports are read-only queries over a finished run. They are printed
+// after a crawl with -report, or against an existing database with
+// -report-only.
+type report struct {
+	Name        string
+	Description string
+	Run         func(db *gorm.DB, w io.Writer, runID string) error
+}
+
+var reports = []report{
+	{"redirects", "source URLs grouped by their final redirect target", redirectTargetsReport},
+	{"crawl-budget", "internal links pointing at noindex pages, grouped by linking page", crawlBudgetReport},
+	{"robots-directives", "pages using each robots meta directive (noarchive, nosnippet, max-snippet, ...)", robotsDirectivesReport},
+	{"heading-density", "pages with far more headings than content, or long pages without headings", headingDensityReport},
+	{"h1", "pages without an h1 or with several, with the h1 texts", h1Report},
+	{"cookies", "pages setting cookies on a first visit, before any consent interaction", cookiesReport},
+	{"pwa", "theme-color, web app manifest and service worker coverage", pwaReport},
+	{"lang-mismatch", "pages whose <html lang> disagrees with the language detected from their text", langMismatchReport},
+	{"page-types", "page count per type (crawl with -classify or -page-type)", pageTypesReport},
+	{"structured-data", "pages whose JSON-LD lacks required fields (crawl with -validate-structured-data)", structuredDataReport},
+	{"canonical-og-url", "pages whose canonical link and og:url disagree", canonicalOGURLReport},
+	{"social-tags", "Open Graph and Twitter Card coverage, and pages missing them", socialTagsReport},
+	{"inbound-links", "pages with the most and the fewest internal pages linking to them", inboundLinksReport},
+	{"anchor-texts", "distinct anchor texts linking to each crawled page, with counts", anchorTextsReport},
+	{"orphans", "crawled pages no other crawled page links to (seed excluded)", orphanPagesReport},
+	{"broken-links", "internal links to pages answering 4xx or 5xx or unreachable, grouped by target (CSV with -csv)", brokenLinksReport},
+	{"duplicates", "pages sharing a title or meta description, grouped by value", duplicatesReport},
+	{"broken-anchors", "in-page #anchor links whose target ID is missing", brokenAnchorsReport},
+	{"canonical-targets", "canonicals pointing at error pages, redirects or robots-disallowed URLs", canonicalTargetsReport},
+	{"canonical-chains", "canonicals pointing at pages that canonicalize elsewhere, and canonical loops", canonicalChainsReport},
+}
+
+func runReports(db *gorm.DB, w io.Writer, names []string, runID string) error {
+	var errs []error
+	for _, name := range names {
+		r, ok := findReport(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown report %q (available: %s)", name, reportNames()))
+			continue
+		}
+		fmt.Fprintf(w, "\n== %s (run %s) ==\n", r.Name, runID)
+		if err := r.Run(db, w, runID); err != nil {
+			errs = append(errs, fmt.Errorf("report %s: %w", r.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func findReport(name string) (report, bool) {
+	for _, r := range reports {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return report{}, false
+}
+
+func reportNames() string {
+	names := make([]string, len(reports))
+	for i, r := range reports {
+		names[i] = r.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// latestRunID returns the run of the most recently crawled page.
+func latestRunID(db *gorm.DB) (string, error) {
+	var page storage.Page
+	err := db.Order("crawled_at DESC").Select("run_id").First(&page).Error
+	if err != nil {
+		return "", fmt.Errorf("no crawled pages found: %w", err)
+	}
+	return page.RunID, nil
+}
+
+// ----------------------------------------------------------------------------
+// Redirect targets
+// ----------------------------------------------------------------------------
+
+// Targets reached from at least this many sources are marked as hubs.
+const redirectHubThreshold = 3
+
+func redirectTargetsReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("final_url <> ''").
+		Select("url", "final_url", "redirect_hops", "redirect_chain", "redirect_loop", "long_redirect_chain").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no redirected pages")
+		return nil
+	}
+
+	sources := make(map[string][]storage.Page)
+	for _, p := range pages {
+		sources[p.FinalURL] = append(sources[p.FinalURL], p)
+	}
+
+	targets := make([]string, 0, len(sources))
+	for target := range sources {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := len(sources[targets[i]]), len(sources[targets[j]])
+		if a != b {
+			return a > b
+		}
+		return targets[i] < targets[j]
+	})
+
+	hubs, longChains, loops := 0, 0, 0
+	for _, target := range targets {
+		marker := ""
+		if len(sources[target]) >= redirectHubThreshold {
+			marker = "  [hub]"
+			hubs++
+		}
+		fmt.Fprintf(w, "%5d  %s%s\n", len(sources[target]), target, marker)
+		for _, p := range sources[target] {
+			flags := ""
+			if p.LongRedirectChain {
+				flags += "  [long]"
+				longChains++
+			}
+			if p.RedirectLoop {
+				flags += "  [loop]"
+				loops++
+			}
+			statuses := ""
+			if s := parser.RedirectStatuses(p.RedirectChain); s != "" {
+				statuses = ": " + s
+			}
+			fmt.Fprintf(w, "         <- %s (%d hops%s)%s\n", p.URL, p.RedirectHops, statuses, flags)
+		}
+	}
+
+	fmt.Fprintf(w, "%d redirected pages, %d targets, %d hubs, %d long chains, %d loops\n", len(pages), len(targets), hubs, longChains, loops)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Crawl budget
+// ----------------------------------------------------------------------------
+
+// crawlBudgetReport lists links whose target was crawled and turned out
+// to be noindex. Every such link spends crawl budget on a page that can't
+// rank.
+func crawlBudgetReport(db *gorm.DB, w io.Writer, runID string) error {
+	type wastedLink struct {
+		FromURL string
+		ToURL   string
+	}
+
+	var links []wastedLink
+	err := db.Table("edges").
+		Distinct("edges.from_url, edges.to_url").
+		Joins("JOIN pages ON pages.run_id = edges.run_id AND pages.url = edges.to_url").
+		Where("edges.run_id = ? AND pages.noindex = ?", runID, true).
+		Order("edges.from_url, edges.to_url").
+		Scan(&links).Error
+	if err != nil {
+		return err
+	}
+
+	if len(links) == 0 {
+		fmt.Fprintln(w, "no links to noindex pages")
+		return nil
+	}
+
+	sources := 0
+	for i, l := range links {
+		if i == 0 || links[i-1].FromURL != l.FromURL {
+			fmt.Fprintln(w, l.FromURL)
+			sources++
+		}
+		fmt.Fprintf(w, "    -> %s (noindex)\n", l.ToURL)
+	}
+
+	fmt.Fprintf(w, "%d links to noindex pages from %d linking pages\n", len(links), sources)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Robots directives
+// ----------------------------------------------------------------------------
+
+// robotsDirectivesReport groups pages by robots meta directive. Values
+// such as max-snippet:50 are grouped under their name.
+func robotsDirectivesReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("robots_directives <> ''").
+		Select("url", "robots_directives").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages with robots directives")
+		return nil
+	}
+
+	type usage struct {
+		url   string
+		value string
+	}
+	byDirective := make(map[string][]usage)
+	for _, p := range pages {
+		for _, directive := range strings.Split(p.RobotsDirectives, ",") {
+			name, _, _ := strings.Cut(directive, ":")
+			byDirective[name] = append(byDirective[name], usage{p.URL, directive})
+		}
+	}
+
+	names := make([]string, 0, len(byDirective))
+	for name := range byDirective {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%s (%d pages)\n", name, len(byDirective[name]))
+		for _, u := range byDirective[name] {
+			if u.value != name {
+				fmt.Fprintf(w, "    %s [%s]\n", u.url, u.value)
+			} else {
+				fmt.Fprintf(w, "    %s\n", u.url)
+			}
+		}
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Orphan pages
+// ----------------------------------------------------------------------------
+
+// orphanPagesReport lists successfully crawled pages without an inbound
+// link from any other crawled page. The seed is excluded since nothing
+// needs to link to it. Only discovery records links, so runs seeded from
+// a sitemap, CSV or API have no link graph to check against.
+func orphanPagesReport(db *gorm.DB, w io.Writer, runID string) error {
+	var edges int64
+	if err := db.Model(&storage.Edge{}).Where("run_id = ?", runID).Count(&edges).Error; err != nil {
+		return err
+	}
+	if edges == 0 {
+		fmt.Fprintln(w, "no links recorded for this run")
+		return nil
+	}
+
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("seed = ? AND status_code BETWEEN 200 AND 299", false).
+		Where("NOT EXISTS (?)", db.Table("edges").Select("1").
+			Where("edges.run_id = pages.run_id AND edges.to_url = pages.url AND edges.from_url <> pages.url")).
+		Select("url").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no orphan pages")
+		return nil
+	}
+
+	for _, p := range pages {
+		fmt.Fprintln(w, p.URL)
+	}
+	fmt.Fprintf(w, "%d orphan pages\n", len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Broken links
+// ----------------------------------------------------------------------------
+
+// brokenLinksReport lists the error pages and unreachable URLs that
+// internal links point at, each with the pages linking to it and the
+// anchor text. The broken_links table is rebuilt first, so runs crawled
+// before it existed are covered too. With -csv it writes one row per link.
+func brokenLinksReport(db *gorm.DB, w io.Writer, runID string) error {
+	if err := storage.UpdateBrokenLinks(db, runID); err != nil {
+		return err
+	}
+
+	var links []storage.BrokenLink
+	err := db.Where("run_id = ?", runID).
+		Order("to_url, from_url, text").
+		Find(&links).Error
+	if err != nil {
+		return err
+	}
+
+	if config.CSVOutput {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"from_url", "to_url", "status_code", "error", "anchor_text"})
+		for _, l := range links {
+			cw.Write([]string{l.FromURL, l.ToURL, strconv.Itoa(l.StatusCode), l.Error, l.Text})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if len(links) == 0 {
+		fmt.Fprintln(w, "no broken internal links")
+		return nil
+	}
+
+	targets := 0
+	for i, l := range links {
+		if i == 0 || links[i-1].ToURL != l.ToURL {
+			targets++
+			if l.StatusCode == 0 {
+				fmt.Fprintf(w, "ERR  %s  (%s)\n", l.ToURL, l.Error)
+			} else {
+				fmt.Fprintf(w, "%d  %s\n", l.StatusCode, l.ToURL)
+			}
+		}
+		if l.Text != "" {
+			fmt.Fprintf(w, "       <- %s  %q\n", l.FromURL, l.Text)
+		} else {
+			fmt.Fprintf(w, "       <- %s\n", l.FromURL)
+		}
+	}
+	fmt.Fprintf(w, "%d broken targets, %d links to them\n", targets, len(links))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Inbound links
+// ----------------------------------------------------------------------------
+
+// Pages listed at each end of the inbound-links report.
+const inboundLinksListed = 10
+
+// inboundLinksReport recounts the inbound links first, so runs crawled
+// before the column existed are covered too.
+func inboundLinksReport(db *gorm.DB, w io.Writer, runID string) error {
+	if err := storage.UpdateInboundLinks(db, runID); err != nil {
+		return err
+	}
+
+	list := func(order string) ([]storage.Page, error) {
+		var pages []storage.Page
+		err := db.Scopes(storage.RunScope(runID)).
+			Where("status_code BETWEEN 200 AND 299").
+			Select("url", "inbound_links").
+			Order(order).
+			Limit(inboundLinksListed).
+			Find(&pages).Error
+		return pages, err
+	}
+
+	top, err := list("inbound_links DESC, url")
+	if err != nil {
+		return err
+	}
+	if len(top) == 0 {
+		fmt.Fprintln(w, "no successful pages")
+		return nil
+	}
+	bottom, err := list("inbound_links, url")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "most linked:")
+	for _, p := range top {
+		fmt.Fprintf(w, "%5d  %s\n", p.InboundLinks, p.URL)
+	}
+	fmt.Fprintln(w, "least linked:")
+	for _, p := range bottom {
+		fmt.Fprintf(w, "%5d  %s\n", p.InboundLinks, p.URL)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Anchor texts
+// ----------------------------------------------------------------------------
+
+// anchorTextsReport aggregates, per crawled page, the anchor texts of the
+// links pointing at it. Pages linked with the most distinct texts come
+// first, since they are the likeliest to have inconsistent anchors; empty
+// anchor text is listed as (empty).
+func anchorTextsReport(db *gorm.DB, w io.Writer, runID string) error {
+	type anchorText struct {
+		ToURL string
+		Text  string
+		Count int
+	}
+
+	var rows []anchorText
+	err := db.Table("edges").
+		Select("edges.to_url, edges.text, COUNT(*) AS count").
+		Joins("JOIN pages ON pages.run_id = edges.run_id AND pages.url = edges.to_url").
+		Where("edges.run_id = ? AND edges.from_url <> edges.to_url", runID).
+		Group("edges.to_url, edges.text").
+		Order("edges.to_url, count DESC, edges.text").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "no internal links recorded")
+		return nil
+	}
+
+	type target struct {
+		URL   string
+		Links int
+		Empty int
+		Texts []anchorText
+	}
+	var targets []*target
+	for _, r := range rows {
+		if len(targets) == 0 || targets[len(targets)-1].URL != r.ToURL {
+			targets = append(targets, &target{URL: r.ToURL})
+		}
+		t := targets[len(targets)-1]
+		t.Links += r.Count
+		if r.Text == "" {
+			t.Empty += r.Count
+		}
+		t.Texts = append(t.Texts, r)
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return len(targets[i].Texts) > len(targets[j].Texts)
+	})
+
+	inconsistent, empty := 0, 0
+	for _, t := range targets {
+		if len(t.Texts) > 1 {
+			inconsistent++
+		}
+		if t.Empty > 0 {
+			empty++
+		}
+		fmt.Fprintf(w, "%s  (%d links, %d distinct texts)\n", t.URL, t.Links, len(t.Texts))
+		for _, a := range t.Texts {
+			text := strconv.Quote(a.Text)
+			if a.Text == "" {
+				text = "(empty)"
+			}
+			fmt.Fprintf(w, "    %5d  %s\n", a.Count, text)
+		}
+	}
+	fmt.Fprintf(w, "%d pages, %d linked with more than one text, %d with empty anchor text\n", len(targets), inconsistent, empty)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Broken anchors
+// ----------------------------------------------------------------------------
+
+// brokenAnchorsReport lists in-page links whose target ID is missing.
+// Individual links are only known for runs crawled with -anchor-details.
+func brokenAnchorsReport(db *gorm.DB, w io.Writer, runID string) error {
+	type brokenAnchor struct {
+		URL      string
+		Fragment string
+		Text     string
+	}
+
+	var anchors []brokenAnchor
+	err := db.Table("anchor_links").
+		Select("pages.url, anchor_links.fragment, anchor_links.text").
+		Joins("JOIN pages ON pages.id = anchor_links.page_id").
+		Where("pages.run_id = ? AND anchor_links.missing = ?", runID, true).
+		Order("pages.url, anchor_links.id").
+		Scan(&anchors).Error
+	if err != nil {
+		return err
+	}
+
+	if len(anchors) == 0 {
+		var pages []storage.Page
+		err := db.Scopes(storage.RunScope(runID)).
+			Where("broken_anchors > 0").
+			Select("url", "broken_anchors").
+			Order("url").
+			Find(&pages).Error
+		if err != nil {
+			return err
+		}
+		if len(pages) == 0 {
+			fmt.Fprintln(w, "no broken in-page anchors")
+			return nil
+		}
+		for _, p := range pages {
+			fmt.Fprintf(w, "%5d  %s\n", p.BrokenAnchors, p.URL)
+		}
+		fmt.Fprintf(w, "%d pages with broken anchors (crawl with -anchor-details to list them)\n", len(pages))
+		return nil
+	}
+
+	pages := 0
+	for i, a := range anchors {
+		if i == 0 || anchors[i-1].URL != a.URL {
+			fmt.Fprintln(w, a.URL)
+			pages++
+		}
+		fmt.Fprintf(w, "    #%s %q\n", a.Fragment, a.Text)
+	}
+	fmt.Fprintf(w, "%d broken anchors on %d pages\n", len(anchors), pages)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Heading density
+// ----------------------------------------------------------------------------
+
+func headingDensityReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("heading_density <> ''").
+		Select("url", "heading_density", "headings", "word_count").
+		Order("heading_density DESC, url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages with anomalous heading density")
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, p := range pages {
+		counts[p.HeadingDensity]++
+		fmt.Fprintf(w, "%-8s  %3d headings  %6d words  %s\n", p.HeadingDensity, p.Headings, p.WordCount, p.URL)
+	}
+	fmt.Fprintf(w, "%d pages with too many headings, %d long pages without headings\n", counts["too-many"], counts["none"])
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// H1
+// ----------------------------------------------------------------------------
+
+// h1Report lists successful pages without an h1, then pages with several
+// along with each h1's text.
+func h1Report(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("h1_issue <> ''").
+		Select("id", "url", "h1_issue", "h1_count").
+		Order("h1_issue, url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages with a missing or repeated h1")
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, p := range pages {
+		counts[p.H1Issue]++
+		if p.H1Issue == "missing" {
+			fmt.Fprintf(w, "missing   %s\n", p.URL)
+			continue
+		}
+
+		fmt.Fprintf(w, "multiple  %s (%d h1s)\n", p.URL, p.H1Count)
+		var texts []string
+		err := db.Model(&storage.Heading{}).
+			Where("page_id = ? AND level = 1", p.ID).
+			Order("position").
+			Pluck("text", &texts).Error
+		if err != nil {
+			return err
+		}
+		for _, text := range texts {
+			fmt.Fprintf(w, "    %q\n", text)
+		}
+	}
+	fmt.Fprintf(w, "%d pages without an h1, %d with more than one\n", counts["missing"], counts["multiple"])
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Cookies
+// ----------------------------------------------------------------------------
+
+// cookiesReport lists pages that set cookies on a first visit, through
+// Set-Cookie headers or inline scripts, and how many pages set each
+// cookie. The crawler never interacts with consent banners, so all of
+// these were set before consent.
+func cookiesReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("set_cookies <> '' OR script_cookies = ?", true).
+		Select("url", "set_cookies", "script_cookies").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages set cookies on first visit")
+		return nil
+	}
+
+	counts := make(map[string]int)
+	scripts := 0
+	for _, p := range pages {
+		var sources []string
+		if p.SetCookies != "" {
+			names := strings.Split(p.SetCookies, ",")
+			for _, name := range names {
+				counts[name]++
+			}
+			sources = append(sources, "Set-Cookie: "+strings.Join(names, ", "))
+		}
+		if p.ScriptCookies {
+			scripts++
+			sources = append(sources, "inline script writes document.cookie")
+		}
+		fmt.Fprintf(w, "%s\n    %s\n", p.URL, strings.Join(sources, "; "))
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "%5d  %s\n", counts[name], name)
+	}
+	fmt.Fprintf(w, "%d pages set cookies before consent (%d through inline scripts)\n", len(pages), scripts)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// PWA readiness
+// ----------------------------------------------------------------------------
+
+// pwaReport summarizes how many successful pages declare a theme-color,
+// link a web app manifest and register a service worker, lists the
+// distinct manifests and theme colors, and the pages missing any of them.
+func pwaReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("status_code BETWEEN 200 AND 299 AND skip_reason = ''").
+		Select("url", "theme_color", "manifest", "service_worker").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no successful pages")
+		return nil
+	}
+
+	var themed, manifests, workers, ready int
+	themeColors := make(map[string]int)
+	manifestURLs := make(map[string]int)
+	var incomplete []storage.Page
+	for _, p := range pages {
+		if p.ThemeColor != "" {
+			themed++
+			themeColors[p.ThemeColor]++
+		}
+		if p.Manifest != "" {
+			manifests++
+			manifestURLs[p.Manifest]++
+		}
+		if p.ServiceWorker {
+			workers++
+		}
+		if p.ThemeColor != "" && p.Manifest != "" && p.ServiceWorker {
+			ready++
+		} else {
+			incomplete = append(incomplete, p)
+		}
+	}
+
+	total := float64(len(pages))
+	fmt.Fprintf(w, "%5d  %5.1f%%  theme-color\n", themed, float64(themed)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  manifest\n", manifests, float64(manifests)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  service worker\n", workers, float64(workers)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  all three\n", ready, float64(ready)/total*100)
+
+	printCounts := func(title string, counts map[string]int) {
+		if len(counts) == 0 {
+			return
+		}
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%5d  %s\n", counts[k], k)
+		}
+	}
+	printCounts("manifests:", manifestURLs)
+	printCounts("theme colors:", themeColors)
+
+	if len(incomplete) > 0 {
+		fmt.Fprintln(w, "\nmissing:")
+		for _, p := range incomplete {
+			var missing []string
+			if p.ThemeColor == "" {
+				missing = append(missing, "theme-color")
+			}
+			if p.Manifest == "" {
+				missing = append(missing, "manifest")
+			}
+			if !p.ServiceWorker {
+				missing = append(missing, "service worker")
+			}
+			fmt.Fprintf(w, "    %s  (%s)\n", p.URL, strings.Join(missing, ", "))
+		}
+	}
+	fmt.Fprintf(w, "%d of %d pages PWA-ready\n", ready, len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Language mismatch
+// ----------------------------------------------------------------------------
+
+func langMismatchReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("lang_mismatch = ?", true).
+		Select("url", "lang", "detected_lang").
+		Order("lang, detected_lang, url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages whose declared and detected language disagree")
+		return nil
+	}
+
+	for _, p := range pages {
+		fmt.Fprintf(w, "declared %-6s detected %-3s %s\n", p.Lang, p.DetectedLang, p.URL)
+	}
+	fmt.Fprintf(w, "%d pages with a language mismatch\n", len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Page types
+// ----------------------------------------------------------------------------
+
+func pageTypesReport(db *gorm.DB, w io.Writer, runID string) error {
+	type typeCount struct {
+		PageType string
+		Count    int
+	}
+
+	var counts []typeCount
+	err := db.Model(&storage.Page{}).Scopes(storage.RunScope(runID)).
+		Where("page_type <> ''").
+		Select("page_type, COUNT(*) AS count").
+		Group("page_type").
+		Order("count DESC, page_type").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	if len(counts) == 0 {
+		fmt.Fprintln(w, "no classified pages (crawl with -classify or -page-type)")
+		return nil
+	}
+
+	total := 0
+	for _, c := range counts {
+		total += c.Count
+	}
+	for _, c := range counts {
+		fmt.Fprintf(w, "%5d  %5.1f%%  %s\n", c.Count, float64(c.Count)/float64(total)*100, c.PageType)
+	}
+	fmt.Fprintf(w, "%d classified pages, %d types\n", total, len(counts))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Structured data
+// ----------------------------------------------------------------------------
+
+// structuredDataReport lists pages with incomplete JSON-LD items and how
+// often each required field is missing.
+func structuredDataReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("structured_data_missing <> ''").
+		Select("url", "structured_data_missing").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages with incomplete structured data (crawl with -validate-structured-data)")
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, p := range pages {
+		missing := strings.Split(p.StructuredDataMissing, ",")
+		for _, field := range missing {
+			counts[field]++
+		}
+		fmt.Fprintf(w, "%s\n    missing %s\n", p.URL, strings.Join(missing, ", "))
+	}
+
+	fields := make([]string, 0, len(counts))
+	for field := range counts {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if counts[fields[i]] != counts[fields[j]] {
+			return counts[fields[i]] > counts[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	fmt.Fprintln(w)
+	for _, field := range fields {
+		fmt.Fprintf(w, "%5d  %s\n", counts[field], field)
+	}
+	fmt.Fprintf(w, "%d pages with incomplete structured data\n", len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Canonical vs og:url
+// ----------------------------------------------------------------------------
+
+func canonicalOGURLReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("canonical_mismatch = ?", true).
+		Select("url", "canonical", "og_url").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no pages with conflicting canonical and og:url")
+		return nil
+	}
+
+	for _, p := range pages {
+		fmt.Fprintln(w, p.URL)
+		fmt.Fprintf(w, "    canonical: %s\n", p.Canonical)
+		fmt.Fprintf(w, "    og:url:    %s\n", p.OGURL)
+	}
+
+	fmt.Fprintf(w, "%d pages with conflicting canonical and og:url\n", len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Social tags
+// ----------------------------------------------------------------------------
+
+// socialTagsReport shows how many pages carry the tags used for link
+// previews, the Twitter card types in use, and what each page lacks.
+// Twitter falls back to og:title and og:image, so only twitter:card is
+// required on top of Open Graph.
+func socialTagsReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("status_code BETWEEN 200 AND 299 AND skip_reason = ''").
+		Select("url", "og_title", "og_description", "og_image", "twitter_card").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "no successful pages")
+		return nil
+	}
+
+	var titles, descriptions, images, cards, complete int
+	cardTypes := make(map[string]int)
+	var incomplete []storage.Page
+	for _, p := range pages {
+		if p.OGTitle != "" {
+			titles++
+		}
+		if p.OGDescription != "" {
+			descriptions++
+		}
+		if p.OGImage != "" {
+			images++
+		}
+		if p.TwitterCard != "" {
+			cards++
+			cardTypes[p.TwitterCard]++
+		}
+		if p.OGTitle != "" && p.OGDescription != "" && p.OGImage != "" && p.TwitterCard != "" {
+			complete++
+		} else {
+			incomplete = append(incomplete, p)
+		}
+	}
+
+	total := float64(len(pages))
+	fmt.Fprintf(w, "%5d  %5.1f%%  og:title\n", titles, float64(titles)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  og:description\n", descriptions, float64(descriptions)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  og:image\n", images, float64(images)/total*100)
+	fmt.Fprintf(w, "%5d  %5.1f%%  twitter:card\n", cards, float64(cards)/total*100)
+
+	if len(cardTypes) > 0 {
+		keys := make([]string, 0, len(cardTypes))
+		for k := range cardTypes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(w, "\ntwitter cards:")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%5d  %s\n", cardTypes[k], k)
+		}
+	}
+
+	if len(incomplete) > 0 {
+		fmt.Fprintln(w, "\nmissing:")
+		for _, p := range incomplete {
+			var missing []string
+			if p.OGTitle == "" {
+				missing = append(missing, "og:title")
+			}
+			if p.OGDescription == "" {
+				missing = append(missing, "og:description")
+			}
+			if p.OGImage == "" {
+				missing = append(missing, "og:image")
+			}
+			if p.TwitterCard == "" {
+				missing = append(missing, "twitter:card")
+			}
+			fmt.Fprintf(w, "    %s  (%s)\n", p.URL, strings.Join(missing, ", "))
+		}
+	}
+	fmt.Fprintf(w, "%d of %d pages with complete social tags\n", complete, len(pages))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+// Canonical targets
+// ----------------------------------------------------------------------------
+
+// canonicalTarget is what is known about the URL a canonical points at.
+type canonicalTarget struct {
+	status     int
+	redirectTo string
+	err        error
+}
+
+// canonicalTargetsReport checks the target of every canonical that
+// doesn't point at its own page. Targets are looked up among the run's
+// pages; targets that weren't crawled are fetched with -canonical-fetch
+// and otherwise listed as unchecked. With -robots the target must also
+// be allowed by robots.txt.
+func canonicalTargetsReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("canonical <> ''").
+		Select("url", "final_url", "canonical").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	var crawled []storage.Page
+	err = db.Scopes(storage.RunScope(runID)).
+		Select("url", "final_url", "status_code").
+		Find(&crawled).Error
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]canonicalTarget, len(crawled))
+	for _, p := range crawled {
+		t := canonicalTarget{status: p.StatusCode}
+		if p.FinalURL != "" {
+			t.redirectTo = p.FinalURL
+			targets[config.Normalizer().OrRaw(p.FinalURL)] = canonicalTarget{status: p.StatusCode}
+		}
+		targets[config.Normalizer().OrRaw(p.URL)] = t
+	}
+
+	// Robots.txt and the targets are fetched as in a crawl, with its
+	// headers, signing and login session.
+	var client *fetch.Client
+	if config.Robots || config.CanonicalFetch {
+		client, err = fetch.New(context.Background(), config.Config.Config)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+
+	problems, unchecked := 0, 0
+	for _, p := range pages {
+		canonical := config.Normalizer().OrRaw(p.Canonical)
+		self := config.Normalizer().OrRaw(p.URL)
+		if p.FinalURL != "" {
+			self = config.Normalizer().OrRaw(p.FinalURL)
+		}
+		if canonical == self {
+			continue
+		}
+
+		var issues []string
+		disallowed := false
+		if config.Robots {
+			if allowed, err := client.Allowed(context.Background(), canonical); err == nil && !allowed {
+				issues = append(issues, "disallowed by robots.txt")
+				disallowed = true
+			}
+		}
+
+		target, ok := targets[canonical]
+		if !ok && config.CanonicalFetch && !disallowed {
+			target = fetchCanonicalTarget(client, canonical)
+			targets[canonical] = target
+			ok = true
+		}
+
+		switch {
+		case !ok:
+			if !disallowed {
+				unchecked++
+			}
+		case target.err != nil:
+			issues = append(issues, "unreachable: "+target.err.Error())
+		case target.redirectTo != "":
+			issues = append(issues, "redirects to "+target.redirectTo)
+		case target.status < 200 || target.status > 299:
+			issues = append(issues, fmt.Sprintf("status %d", target.status))
+		}
+
+		if len(issues) == 0 {
+			continue
+		}
+		problems++
+		fmt.Fprintln(w, p.URL)
+		fmt.Fprintf(w, "    canonical: %s (%s)\n", p.Canonical, strings.Join(issues, ", "))
+	}
+
+	if problems == 0 {
+		fmt.Fprintln(w, "no problematic canonicals")
+	} else {
+		fmt.Fprintf(w, "%d problematic canonicals\n", problems)
+	}
+	if unchecked > 0 {
+		fmt.Fprintf(w, "%d canonical targets weren't crawled; use -canonical-fetch to check them\n", unchecked)
+	}
+	return nil
+}
+
+// fetchCanonicalTarget requests a canonical target that wasn't crawled
+// and records its status and whether it redirected.
+func fetchCanonicalTarget(client *fetch.Client, target string) canonicalTarget {
+	resp, err := client.Get(context.Background(), target)
+	if err != nil {
+		return canonicalTarget{err: err}
+	}
+	defer resp.Body.Close()
+
+	t := canonicalTarget{status: resp.StatusCode}
+	if _, hops := parser.RedirectSource(resp); hops > 0 {
+		t.redirectTo = resp.Request.URL.String()
+	}
+	return t
+}
+
+// ----------------------------------------------------------------------------
+// Canonical chains
+// ----------------------------------------------------------------------------
+
+// canonicalChainsReport follows canonical links between crawled pages.
+// A chain is a canonical pointing at a page whose own canonical points
+// somewhere else again; a loop is a chain that comes back to a page it
+// already visited. Self-referencing canonicals end a chain.
+func canonicalChainsReport(db *gorm.DB, w io.Writer, runID string) error {
+	var pages []storage.Page
+	err := db.Scopes(storage.RunScope(runID)).
+		Where("canonical <> ''").
+		Select("url", "final_url", "canonical").
+		Order("url").
+		Find(&pages).Error
+	if err != nil {
+		return err
+	}
+
+	canonicalOf := make(map[string]string, len(pages))
+	for _, p := range pages {
+		target := config.Normalizer().OrRaw(p.Canonical)
+		canonicalOf[config.Normalizer().OrRaw(p.URL)] = target
+		if p.FinalURL != "" {
+			canonicalOf[config.Normalizer().OrRaw(p.FinalURL)] = target
+		}
+	}
+
+	var chains [][]string
+	loops := make(map[string][]string)
+	for _, p := range pages {
+		start := config.Normalizer().OrRaw(p.URL)
+		path := []string{start}
+		visited := map[string]int{start: 0}
+
+		for cur := start; ; {
+			next, ok := canonicalOf[cur]
+			if !ok || next == cur {
+				break
+			}
+			if i, seen := visited[next]; seen {
+				loop := rotateLoop(path[i:])
+				loops[strings.Join(loop, " ")] = loop
+				path = nil
+				break
+			}
+			visited[next] = len(path)
+			path = append(path, next)
+			cur = next
+		}
+
+		if len(path) > 2 {
+			chains = append(chains, path)
+		}
+	}
+
+	if len(chains) == 0 && len(loops) == 0 {
+		fmt.Fprintln(w, "no canonical chains or loops")
+		return nil
+	}
+
+	for _, chain := range chains {
+		fmt.Fprintf(w, "chain (%d hops)\n", len(chain)-1)
+		printCanonicalPath(w, chain)
+	}
+
+	keys := make([]string, 0, len(loops))
+	for key := range loops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		loop := loops[key]
+		fmt.Fprintf(w, "loop (%d pages)\n", len(loop))
+		printCanonicalPath(w, append(loop, loop[0]))
+	}
+
+	fmt.Fprintf(w, "%d canonical chains, %d canonical loops\n", len(chains), len(loops))
+	return nil
+}
+
+func printCanonicalPath(w io.Writer, path []string) {
+	fmt.Fprintf(w, "    %s\n", path[0])
+	for _, u := range path[1:] {
+		fmt.Fprintf(w, "      -> %s\n", u)
+	}
+}
+
+// rotateLoop starts a loop at its smallest URL so the same loop found
+// from different pages is reported once.
+func rotateLoop(loop []string) []string {
+	first := 0
+	for i, u := range loop {
+		if u < loop[first] {
+			first = i
+		}
+	}
+	return append(slices.Clone(loop[first:]), loop[:first]...)
+}
+
+// ----------------------------------------------------------------------------
+// Stats history
+// ----------------------------------------------------------------------------
+
+// printStatsHistory lists every CrawlStats row recorded for startURL,
+// oldest first, as a table or as CSV for charting.
+func printStatsHistory(db *gorm.DB, w io.Writer, startURL string, asCSV bool) error {
+	var rows []storage.CrawlStats
+	err := db.Where("start_url = ?", startURL).Order("crawled_at").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no crawl stats recorded for %s", startURL)
+	}
+
+	header := []string{"crawled_at", "run_id", "total", "success", "failed", "success_rate", "duration_s", "partial", "avg_ms", "p90_ms", "avg_body_bytes"}
+	record := func(s storage.CrawlStats) []string {
+		rate := 0.0
+		if s.TotalPages > 0 {
+			rate = float64(s.SuccessPages) / float64(s.TotalPages) * 100
+		}
+		return []string{
+			s.CrawledAt.Format(time.RFC3339),
+			s.RunID,
+			strconv.Itoa(s.TotalPages),
+			strconv.Itoa(s.SuccessPages),
+			strconv.Itoa(s.FailedPages),
+			strconv.FormatFloat(rate, 'f', 1, 64),
+			strconv.FormatInt(s.Duration, 10),
+			strconv.FormatBool(s.Partial),
+			strconv.FormatInt(s.AvgResponseMillis, 10),
+			strconv.FormatInt(s.P90ResponseMillis, 10),
+			strconv.FormatInt(s.AvgBodyBytes, 10),
+		}
+	}
+
+	if asCSV {
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for _, s := range rows {
+			cw.Write(record(s))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, s := range rows {
+		fmt.Fprintln(tw, strings.Join(record(s), "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// ============================================================================
+// RUNTIME DIAGNOSTICS
+// ============================================================================
+
+// logRuntimeStats logs goroutine count, heap and GC figures every
+// interval for as long as the process runs (-debug-runtime). Reading
+// MemStats briefly stops the world, so keep the interval in seconds.
+func logRuntimeStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastNumGC uint32
+	for range ticker.C {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		_, progress := activeProgress()
+
+		// Longest pause among the collections since the last sample.
+		var maxPause time.Duration
+		runs := min(m.NumGC-lastNumGC, uint32(len(m.PauseNs)))
+		for i := uint32(0); i < runs; i++ {
+			pause := m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))]
+			maxPause = max(maxPause, time.Duration(pause))
+		}
+
+		slog.Info("runtime",
+			"goroutines", runtime.NumGoroutine(),
+			"heap_alloc_mb", m.HeapAlloc>>20,
+			"heap_objects", m.HeapObjects,
+			"sys_mb", m.Sys>>20,
+			"gc_runs", m.NumGC-lastNumGC,
+			"gc_max_pause", maxPause,
+			"gc_total_pause", time.Duration(m.PauseTotalNs),
+			"pages", progress.Completed)
+		lastNumGC = m.NumGC
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"crawl-guardian.com/crawler"
+)
+
+// ============================================================================
+// SERVER MODE
+// ============================================================================
+
+// With -listen the crawler serves health checks while it runs and keeps
+// serving after the crawl until it receives SIGINT or SIGTERM, so it can
+// run as a long-lived service under an orchestrator.
+
+const (
+	healthIdle     = "idle"
+	healthActive   = "active"
+	healthErrored  = "errored"
+	healthStopping = "stopping"
+)
+
+type healthStatus struct {
+	mu      sync.Mutex
+	state   string
+	err     string
+	started time.Time
+}
+
+var health = &healthStatus{state: healthIdle, started: time.Now()}
+
+// active is the crawler of the running crawl, or of the last one.
+var active atomic.Pointer[crawler.Crawler]
+
+// activeProgress returns the run and page counts of the active crawler,
+// or the configured run with no pages before the first crawl starts.
+func activeProgress() (string, crawler.Progress) {
+	c := active.Load()
+	if c == nil {
+		return config.RunID, crawler.Progress{}
+	}
+	return c.RunID(), c.Progress()
+}
+
+func (h *healthStatus) Set(state string) {
+	h.mu.Lock()
+	h.state = state
+	if state != healthErrored {
+		h.err = ""
+	}
+	h.mu.Unlock()
+}
+
+func (h *healthStatus) Fail(err error) {
+	h.mu.Lock()
+	h.state = healthErrored
+	h.err = err.Error()
+	h.mu.Unlock()
+}
+
+// handleHealthz reports the crawl state. It answers 503 while shutting
+// down or after a failed crawl so the instance is taken out of rotation.
+func (h *healthStatus) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	state, errMsg := h.state, h.err
+	h.mu.Unlock()
+	runID, progress := activeProgress()
+
+	ready := state == healthIdle || state == healthActive
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   state,
+		"ready":    ready,
+		"run_id":   runID,
+		"pages":    progress.Completed,
+		"failed":   progress.Failed,
+		"uptime_s": int64(time.Since(h.started).Seconds()),
+		"error":    errMsg,
+	})
+}
+
+// handleLivez only shows that the process is serving requests.
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+func startServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.handleHealthz)
+	mux.HandleFunc("/livez", handleLivez)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("serving health checks", "addr", addr)
+	return srv
+}
+
+// serveUntilSignal blocks until SIGINT or SIGTERM, then reports "stopping"
+// for -shutdown-grace so load balancers notice before the server closes.
+func serveUntilSignal(srv *http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	slog.Info("shutting down", "grace", config.ShutdownGrace)
+	health.Set(healthStopping)
+	time.Sleep(config.ShutdownGrace)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", "error", err)
+	}
+}
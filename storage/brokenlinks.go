@@ -0,0 +1,46 @@
+package storage
+
+import "gorm.io/gorm"
+
+// ============================================================================
+// BROKEN LINKS
+// ============================================================================
+
+// BrokenLink is an internal link whose target answered 4xx or 5xx, or
+// couldn't be fetched at all (StatusCode 0, with the error). The table is
+// rebuilt from the edges and pages of a run after each crawl.
+type BrokenLink struct {
+	ID         uint   `gorm:"primaryKey"`
+	RunID      string `gorm:"index:idx_broken_run_to,priority:1"`
+	FromURL    string `gorm:"size:2000"`
+	ToURL      string `gorm:"size:2000;index:idx_broken_run_to,priority:2,length:500"`
+	Text       string `gorm:"size:500"` // anchor text of the link
+	StatusCode int    `gorm:"index"`
+	Error      string `gorm:"size:500"`
+}
+
+// UpdateBrokenLinks replaces the broken links of a run with the internal
+// edges leading to its error pages and unreachable URLs.
+func UpdateBrokenLinks(db *gorm.DB, runID string) error {
+	var links []BrokenLink
+	err := db.Table("edges").
+		Select("DISTINCT edges.run_id, edges.from_url, edges.to_url, edges.text, pages.status_code, pages.fetch_error AS error").
+		Joins("JOIN pages ON pages.run_id = edges.run_id AND pages.url = edges.to_url").
+		Where("edges.run_id = ? AND edges.internal = ?", runID, true).
+		Where("pages.status_code >= 400 OR (pages.status_code = 0 AND pages.fetch_error <> '')").
+		Order("edges.to_url, edges.from_url").
+		Scan(&links).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", runID).Delete(&BrokenLink{}).Error; err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&links, 100).Error
+	})
+}
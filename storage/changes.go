@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CHANGE DETECTION
+// ============================================================================
+
+// Change statuses of a page against another run. A page counts as
+// changed when its visible text hash or its status code differ; markup,
+// scripts and timestamps in attributes don't make it change.
+const (
+	ChangeNew       = "new"
+	ChangeChanged   = "changed"
+	ChangeUnchanged = "unchanged"
+	ChangeRemoved   = "removed"
+)
+
+// PreviousRunID returns the latest other run crawled from the same start
+// URL, or "" if there is none.
+func PreviousRunID(db *gorm.DB, runID, startURL string) (string, error) {
+	var stats CrawlStats
+	err := db.Where("start_url = ? AND run_id <> ?", startURL, runID).
+		Order("crawled_at DESC").
+		First(&stats).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return stats.RunID, err
+}
+
+// RemovedPage is a page of the previous run from the same start URL that
+// a run no longer has. The table is rebuilt for a run after each crawl.
+type RemovedPage struct {
+	ID         uint   `gorm:"primaryKey"`
+	RunID      string `gorm:"index"`
+	PrevRunID  string
+	URL        string `gorm:"size:2000"`
+	StatusCode int    // in the previous run
+}
+
+// UpdatePageChanges sets ChangeStatus on every page of a run against the
+// pages of prevRunID.
+func UpdatePageChanges(db *gorm.DB, runID, prevRunID string) error {
+	if db.Dialector.Name() == "mysql" {
+		// MySQL can't read the table an UPDATE writes in a subquery, so
+		// the previous run is joined instead.
+		return db.Exec(`UPDATE pages LEFT JOIN pages AS prev ON prev.run_id = ? AND prev.url = pages.url
+			SET pages.change_status = CASE
+				WHEN prev.id IS NULL THEN ?
+				WHEN prev.text_hash = pages.text_hash AND prev.status_code = pages.status_code THEN ?
+				ELSE ? END
+			WHERE pages.run_id = ?`,
+			prevRunID, ChangeNew, ChangeUnchanged, ChangeChanged, runID).Error
+	}
+
+	prev := func() *gorm.DB {
+		return db.Table("pages AS prev").
+			Select("1").
+			Where("prev.run_id = ? AND prev.url = pages.url", prevRunID)
+	}
+	status := gorm.Expr("CASE WHEN NOT EXISTS (?) THEN ? WHEN EXISTS (?) THEN ? ELSE ? END",
+		prev(), ChangeNew,
+		prev().Where("prev.text_hash = pages.text_hash AND prev.status_code = pages.status_code"), ChangeUnchanged,
+		ChangeChanged)
+	return db.Model(&Page{}).
+		Where("run_id = ?", runID).
+		Update("change_status", status).Error
+}
+
+// UpdateRemovedPages replaces the removed pages of a run with the pages
+// of prevRunID it doesn't have, and returns how many there are. With
+// -on-recrawl update these are the rows prevRunID still holds, the ones
+// no page of the run overwrote.
+func UpdateRemovedPages(db *gorm.DB, runID, prevRunID string) (int, error) {
+	var removed []RemovedPage
+	err := db.Model(&Page{}).
+		Select("? AS run_id, run_id AS prev_run_id, url, status_code", runID).
+		Where("run_id = ?", prevRunID).
+		Where("url NOT IN (?)", db.Model(&Page{}).Select("url").Where("run_id = ?", runID)).
+		Order("url").
+		Scan(&removed).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", runID).Delete(&RemovedPage{}).Error; err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&removed, 100).Error
+	})
+	return len(removed), err
+}
+
+// PageChange is one URL whose page differs between two runs.
+type PageChange struct {
+	URL       string
+	Status    string
+	OldStatus int // status codes; 0 when the URL is missing from that run
+	NewStatus int
+}
+
+// DiffRuns compares the pages of two runs by URL. Unchanged pages are
+// only counted.
+func DiffRuns(db *gorm.DB, oldRunID, newRunID string) ([]PageChange, int, error) {
+	load := func(runID string) (map[string]Page, error) {
+		var pages []Page
+		err := db.Where("run_id = ?", runID).
+			Select("url", "status_code", "text_hash").
+			Find(&pages).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(pages) == 0 {
+			return nil, fmt.Errorf("run %s has no pages", runID)
+		}
+		byURL := make(map[string]Page, len(pages))
+		for _, p := range pages {
+			byURL[p.URL] = p
+		}
+		return byURL, nil
+	}
+	oldPages, err := load(oldRunID)
+	if err != nil {
+		return nil, 0, err
+	}
+	newPages, err := load(newRunID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var changes []PageChange
+	unchanged := 0
+	for url, p := range newPages {
+		old, ok := oldPages[url]
+		switch {
+		case !ok:
+			changes = append(changes, PageChange{URL: url, Status: ChangeNew, NewStatus: p.StatusCode})
+		case old.TextHash != p.TextHash || old.StatusCode != p.StatusCode:
+			changes = append(changes, PageChange{URL: url, Status: ChangeChanged, OldStatus: old.StatusCode, NewStatus: p.StatusCode})
+		default:
+			unchanged++
+		}
+	}
+	for url, old := range oldPages {
+		if _, ok := newPages[url]; !ok {
+			changes = append(changes, PageChange{URL: url, Status: ChangeRemoved, OldStatus: old.StatusCode})
+		}
+	}
+
+	order := map[string]int{ChangeNew: 0, ChangeChanged: 1, ChangeRemoved: 2}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Status != b.Status {
+			return order[a.Status] < order[b.Status]
+		}
+		return a.URL < b.URL
+	})
+	return changes, unchanged, nil
+}
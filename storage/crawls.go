@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CRAWLS
+// ============================================================================
+
+// Crawl numbers the runs kept in a database. Every page points at its
+// crawl through CrawlID, next to the run ID it is stored under, so the
+// history of a site can be queried by number. A resumed run keeps its
+// crawl.
+type Crawl struct {
+	ID         uint   `gorm:"primaryKey"`
+	RunID      string `gorm:"uniqueIndex:,length:191;not null"`
+	StartedAt  time.Time
+	FinishedAt *time.Time // nil while running, or when the crawl crashed
+}
+
+// BeginCrawl returns the crawl of runID, registering it on first use.
+func BeginCrawl(db *gorm.DB, runID string) (uint, error) {
+	crawl := Crawl{RunID: runID, StartedAt: time.Now()}
+	if err := db.Where("run_id = ?", runID).FirstOrCreate(&crawl).Error; err != nil {
+		return 0, err
+	}
+	return crawl.ID, nil
+}
+
+// FinishCrawl records when a crawl ended.
+func FinishCrawl(db *gorm.DB, id uint) error {
+	return db.Model(&Crawl{}).Where("id = ?", id).Update("finished_at", time.Now()).Error
+}
+
+// backfillCrawls registers the runs stored before crawls were numbered,
+// in the order they were crawled, and links their pages.
+func backfillCrawls(db *gorm.DB) error {
+	for {
+		// The earliest page of a run not numbered yet starts the next crawl.
+		var first Page
+		err := db.Select("run_id", "crawled_at").
+			Where("crawl_id = 0 OR crawl_id IS NULL").
+			Order("crawled_at").
+			First(&first).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		crawl := Crawl{RunID: first.RunID, StartedAt: first.CrawledAt}
+		if err := db.Where("run_id = ?", first.RunID).FirstOrCreate(&crawl).Error; err != nil {
+			return err
+		}
+		err = db.Model(&Page{}).
+			Where("run_id = ? AND (crawl_id = 0 OR crawl_id IS NULL)", first.RunID).
+			Update("crawl_id", crawl.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ResolveRunID accepts a run ID or a crawl number and returns the run ID.
+// A run named like a number wins over the crawl with that number.
+func ResolveRunID(db *gorm.DB, ref string) (string, error) {
+	id, err := strconv.ParseUint(ref, 10, 64)
+	if err != nil {
+		return ref, nil
+	}
+	var count int64
+	if err := db.Model(&Crawl{}).Where("run_id = ?", ref).Count(&count).Error; err != nil || count > 0 {
+		return ref, err
+	}
+
+	var crawl Crawl
+	err = db.First(&crawl, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("no run or crawl %s", ref)
+	}
+	return crawl.RunID, err
+}
+
+// ResolveRunIDs resolves each of refs with ResolveRunID.
+func ResolveRunIDs(db *gorm.DB, refs []string) ([]string, error) {
+	runIDs := make([]string, len(refs))
+	for i, ref := range refs {
+		runID, err := ResolveRunID(db, ref)
+		if err != nil {
+			return nil, err
+		}
+		runIDs[i] = runID
+	}
+	return runIDs, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// DUPLICATE TITLES AND META DESCRIPTIONS
+// ============================================================================
+
+// Duplicate is a page sharing its title or meta description with other
+// pages of the same run, one row per page and field. The table is rebuilt
+// from the pages of a run after each crawl; only successful HTML pages
+// with a non-empty value count.
+type Duplicate struct {
+	ID    uint   `gorm:"primaryKey"`
+	RunID string `gorm:"index:idx_duplicate_run_field,priority:1"`
+	Field string `gorm:"size:20;index:idx_duplicate_run_field,priority:2"` // title or meta_description
+	Value string `gorm:"size:1000"`
+	URL   string `gorm:"size:2000"`
+	Pages int    // pages sharing Value, this one included
+}
+
+// AuditHTMLPages selects the pages content checks apply to: successful
+// ones whose HTML was parsed.
+const AuditHTMLPages = "status_code BETWEEN 200 AND 299 AND skip_reason = ''"
+
+// DuplicateFields are the page columns checked for duplicates.
+var DuplicateFields = []string{"title", "meta_description"}
+
+// UpdateDuplicates replaces the duplicates of a run with the pages whose
+// title or meta description is also another page's.
+func UpdateDuplicates(db *gorm.DB, runID string) error {
+	var dups []Duplicate
+	for _, field := range DuplicateFields {
+		htmlPages := func() *gorm.DB {
+			return db.Model(&Page{}).Scopes(RunScope(runID)).Where(AuditHTMLPages).Where(field + " <> ''")
+		}
+		shared := htmlPages().Select(field + " AS value, COUNT(*) AS pages").Group(field).Having("COUNT(*) > 1")
+
+		var rows []Duplicate
+		err := htmlPages().
+			Select("pages.run_id, shared.value, pages.url, shared.pages").
+			Joins("JOIN (?) AS shared ON shared.value = pages."+field, shared).
+			Order("shared.value, pages.url").
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		for i := range rows {
+			rows[i].Field = field
+		}
+		dups = append(dups, rows...)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", runID).Delete(&Duplicate{}).Error; err != nil {
+			return err
+		}
+		if len(dups) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&dups, 100).Error
+	})
+}
+
+// DuplicateGroup is the pages sharing one value of a field.
+type DuplicateGroup struct {
+	Value string
+	URLs  []string
+}
+
+// LoadDuplicates returns the duplicate groups of field in a run, largest
+// first.
+func LoadDuplicates(db *gorm.DB, runID, field string) ([]DuplicateGroup, error) {
+	var rows []Duplicate
+	err := db.Where("run_id = ? AND field = ?", runID, field).Order("value, url").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	for i, row := range rows {
+		if i == 0 || rows[i-1].Value != row.Value {
+			groups = append(groups, DuplicateGroup{Value: row.Value})
+		}
+		g := &groups[len(groups)-1]
+		g.URLs = append(g.URLs, row.URL)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].URLs) > len(groups[j].URLs) })
+	return groups, nil
+}
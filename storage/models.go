@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CRAWL STATE
+// ============================================================================
+
+// HostBudget is the request count of one host in the current budget
+// window. It is stored so a restarted crawler keeps counting against the
+// same window instead of starting from zero.
+type HostBudget struct {
+	Host        string `gorm:"primaryKey"`
+	WindowStart time.Time
+	Count       int
+}
+
+// FrontierItem is a URL known to a streaming crawl. The table doubles as
+// the visited set, so memory use doesn't grow with the size of the site.
+type FrontierItem struct {
+	ID             uint   `gorm:"primaryKey"`
+	RunID          string `gorm:"uniqueIndex:idx_frontier_run_url_hash;index:idx_frontier_run_state,priority:1;not null"`
+	URL            string `gorm:"type:text;not null"`
+	URLHash        string `gorm:"size:64;uniqueIndex:idx_frontier_run_url_hash;not null;default:''"` // see URLHash, set on save
+	State          string `gorm:"size:20;index:idx_frontier_run_state,priority:2"`
+	ScopeException bool
+	Depth          int
+	LastMod        *time.Time // from the sitemap, with -with-sitemap
+	Priority       *float64
+	CreatedAt      time.Time
+}
+
+// BeforeSave sets URLHash from URL.
+func (f *FrontierItem) BeforeSave(*gorm.DB) error {
+	if f.URL != "" {
+		f.URLHash = URLHash(f.URL)
+	}
+	return nil
+}
+
+// ConcurrencySample records the worker limit chosen by the auto-tuner at
+// the end of each control interval, with the feedback that led to it.
+type ConcurrencySample struct {
+	ID           uint   `gorm:"primaryKey"`
+	RunID        string `gorm:"index"`
+	Limit        int
+	Requests     int
+	ErrorRate    float64
+	AvgLatencyMs int64
+	SampledAt    time.Time
+}
+
+// APIRecord is one item extracted from a JSON API response with
+// -api-records, stored as raw JSON.
+type APIRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	RunID     string `gorm:"index"`
+	Endpoint  string `gorm:"size:2000"`
+	Page      int
+	Data      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// PAGES
+// ============================================================================
+
+// Pages are unique by run and URLHash, which fits in an index key on
+// every backend however long the URL. On MySQL, whose index keys are
+// limited to 3072 bytes, the lookup indexes on URLs cover their first 500
+// characters, and the URLs that aren't indexed are TEXT to keep rows
+// within its 65535-byte limit.
+type Page struct {
+	ID                    uint   `gorm:"primaryKey"`
+	RunID                 string `gorm:"uniqueIndex:idx_run_url_hash;not null;default:''"`
+	CrawlID               uint   `gorm:"index"` // numbered run, see Crawl
+	URL                   string `gorm:"type:text;index:idx_pages_url_lookup,length:500;not null"`
+	URLHash               string `gorm:"size:64;uniqueIndex:idx_run_url_hash;not null;default:''"` // see URLHash, set on save
+	Title                 string `gorm:"size:500"`
+	H1                    string `gorm:"size:500"`
+	MetaDescription       string `gorm:"size:1000"`
+	Meta                  string `gorm:"type:text"` // JSON object of the -meta watchlist tags found
+	Lang                  string `gorm:"size:35"`   // <html lang>
+	DetectedLang          string `gorm:"size:2"`    // guessed from the visible text, empty if unsure
+	LangMismatch          bool   `gorm:"index"`     // Lang and DetectedLang disagree
+	StatusCode            int    `gorm:"index"`
+	Noindex               bool   `gorm:"index"`
+	Nofollow              bool
+	RobotsDirectives      string `gorm:"size:500"`                    // comma-separated, as found in robots meta tags
+	FinalURL              string `gorm:"size:2000;index:,length:500"` // set when the URL redirected
+	RedirectHops          int
+	RedirectChain         string `gorm:"type:text"` // JSON list of {url, status} hops, the final response last
+	RedirectLoop          bool   `gorm:"index"`     // the chain came back to a URL it had already visited
+	LongRedirectChain     bool   `gorm:"index"`     // more than -redirect-hops-warn hops
+	Canonical             string `gorm:"type:text"`
+	OGURL                 string `gorm:"type:text"`
+	OGTitle               string `gorm:"size:500"`
+	OGDescription         string `gorm:"size:1000"`
+	OGImage               string `gorm:"type:text"`
+	TwitterCard           string `gorm:"size:50;index"` // summary, summary_large_image, ...
+	TwitterTitle          string `gorm:"size:500"`
+	TwitterDescription    string `gorm:"size:1000"`
+	TwitterImage          string `gorm:"type:text"`
+	CanonicalMismatch     bool   `gorm:"index"` // canonical and og:url both set but different
+	InlineScripts         int
+	ExternalScripts       int
+	InlineStyles          int
+	Stylesheets           int
+	WordCount             int
+	Headings              int   // h1-h6 elements
+	DNSMillis             int64 // request phase timings, set with -trace-timings
+	ConnectMillis         int64
+	TLSMillis             int64
+	TTFBMillis            int64      // time to first byte of the last hop
+	TotalMillis           int64      // response time: all redirect hops plus reading the body
+	SetCookies            string     `gorm:"size:1000"`     // comma-separated names from Set-Cookie headers, values are not stored
+	ScriptCookies         bool       `gorm:"index"`         // an inline script assigns document.cookie
+	HeadingDensity        string     `gorm:"size:20;index"` // too-many, none or empty, see -heading-words
+	H1Count               int        // h1 elements; their text is in the headings table
+	H1Issue               string     `gorm:"size:10;index"` // missing, multiple or empty, see parser.H1Issue
+	InboundLinks          int        `gorm:"index"`         // distinct crawled pages on its host linking here, set after the crawl
+	AnchorLinks           int        // in-page href="#..." links
+	BrokenAnchors         int        `gorm:"index"` // in-page links to IDs missing from the page
+	ThinContent           bool       `gorm:"index"`
+	JSONLDTypes           string     `gorm:"size:500"`      // comma-separated JSON-LD @type values
+	PageType              string     `gorm:"size:50;index"` // set with -classify or -page-type
+	StructuredDataValid   bool       `gorm:"index"`         // false when a JSON-LD item lacks a required field
+	StructuredDataMissing string     `gorm:"size:500"`      // comma-separated Type.field, set with -validate-structured-data
+	LastMod               *time.Time // sitemap <lastmod>
+	SitemapPriority       *float64   // sitemap <priority>
+	Seed                  bool       // the -url crawl started from
+	ScopeException        bool       // out of scope, reached through a scope exception
+	Depth                 int        `gorm:"index"` // link hops from the seed, as discovered
+	ThemeColor            string     `gorm:"size:50"`
+	Manifest              string     `gorm:"type:text"` // <link rel="manifest"> href
+	ServiceWorker         bool       // a script appears to register a service worker
+	ContentHash           string     `gorm:"size:64"`       // SHA-256 of the body
+	TextHash              string     `gorm:"size:64"`       // SHA-256 of the visible text, compared between runs
+	ChangeStatus          string     `gorm:"size:10;index"` // new, changed or unchanged since the previous run, set after the crawl
+	LocalIP               string     `gorm:"size:45"`       // local address the request left from, set with -record-egress
+	Proxy                 string     `gorm:"size:255"`      // proxy the request went through, set with -record-egress
+	Reused                bool       // unchanged since the previous run, copied instead of extracted (-hash-gate)
+	Attempts              int        // requests it took to fetch, see -max-attempts
+	SkipReason            string     `gorm:"size:30;index"`  // too-large: fetched headers only; not-html: body not parsed
+	FetchError            string     `gorm:"size:500"`       // set when the request failed; StatusCode is 0
+	ContentType           string     `gorm:"size:100;index"` // media type, from the header or sniffed
+	ETag                  string     `gorm:"size:200"`       // validators sent back with -revalidate
+	LastModified          string     `gorm:"size:100"`
+	Truncated             bool       `gorm:"index"` // body cut off at -max-body-bytes
+	Rendered              bool       // body is the DOM headless Chrome rendered, see -render
+	ContentLength         int64      // announced by the server, -1 if unknown
+	BodyBytes             int64      // body bytes read, after decompression; 0 when not read
+	CrawledAt             time.Time  `gorm:"index"`
+	CreatedAt             time.Time
+}
+
+// Edge is a link from one crawled page to another URL, recorded during
+// discovery.
+type Edge struct {
+	ID       uint   `gorm:"primaryKey"`
+	RunID    string `gorm:"index:idx_edge_run_from,priority:1;index:idx_edge_run_to,priority:1"`
+	FromURL  string `gorm:"size:2000;index:idx_edge_run_from,priority:2,length:500"`
+	ToURL    string `gorm:"size:2000;index:idx_edge_run_to,priority:2,length:500"`
+	Text     string `gorm:"size:500"` // anchor text, or the alt of a linked image
+	Rel      string `gorm:"size:200"`
+	Internal bool   // ToURL is on FromURL's host
+}
+
+// Resource is a script or stylesheet referenced by a page, stored when
+// resource listing is enabled.
+type Resource struct {
+	ID     uint   `gorm:"primaryKey"`
+	PageID uint   `gorm:"index;not null"`
+	Kind   string `gorm:"size:20;index"` // script, stylesheet
+	Inline bool
+	URL    string `gorm:"size:2000"`
+	Size   int    // bytes of inline content
+}
+
+type CrawlStats struct {
+	ID           uint `gorm:"primaryKey"`
+	TotalPages   int
+	SuccessPages int
+	FailedPages  int
+	Duration     int64 // seconds
+	StartURL     string
+	RunID        string `gorm:"index"`
+	Partial      bool   // crawl still running (or crashed) when last written
+	Interrupted  bool   // stopped early by SIGINT/SIGTERM or a canceled context
+	EgressIP     string // public IP reported by -egress-echo-url, set with -record-egress
+
+	// Response times and sizes over the run's pages that got a response,
+	// in milliseconds and bytes; set when the crawl ends.
+	TimedPages        int
+	AvgResponseMillis int64
+	P50ResponseMillis int64
+	P90ResponseMillis int64
+	P99ResponseMillis int64
+	MaxResponseMillis int64
+	AvgTTFBMillis     int64
+	AvgBodyBytes      int64
+	TotalBodyBytes    int64
+
+	CrawledAt time.Time
+}
+
+// AnchorLink is an in-page link (href="#section") and whether its target
+// ID exists on the page, stored with -anchor-details.
+type AnchorLink struct {
+	ID       uint   `gorm:"primaryKey"`
+	PageID   uint   `gorm:"index;not null"`
+	Fragment string `gorm:"size:500"`
+	Text     string `gorm:"size:500"`
+	Missing  bool   `gorm:"index"`
+}
+
+// Heading is one h1-h6 element of a page, in document order.
+type Heading struct {
+	ID       uint   `gorm:"primaryKey"`
+	PageID   uint   `gorm:"index;not null"`
+	Level    int    `gorm:"index"` // 1 for h1 ... 6 for h6
+	Position int    // 0-based index among the page's headings
+	Text     string `gorm:"type:text"`
+}
+
+// URLHash returns the hex SHA-256 of url, which pages and frontier items
+// are unique by within a run.
+func URLHash(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// BeforeSave sets URLHash from URL.
+func (p *Page) BeforeSave(*gorm.DB) error {
+	if p.URL != "" {
+		p.URLHash = URLHash(p.URL)
+	}
+	return nil
+}
+
+// UpdateInboundLinks sets InboundLinks on every page of a run to the
+// number of distinct other pages of the run on its host linking to it.
+// Links from other hosts, see Edge.Internal, are not counted.
+func UpdateInboundLinks(db *gorm.DB, runID string) error {
+	inbound := db.Table("edges").
+		Select("COUNT(DISTINCT edges.from_url)").
+		Where("edges.run_id = pages.run_id AND edges.to_url = pages.url AND edges.from_url <> pages.url").
+		Where("edges.internal = ?", true)
+	return db.Model(&Page{}).
+		Where("run_id = ?", runID).
+		Update("inbound_links", inbound).Error
+}
+
+// AddResponseStats sets the response time and size aggregates of stats
+// from the pages of runID that got a response.
+func AddResponseStats(db *gorm.DB, stats *CrawlStats, runID string) error {
+	timed := db.Model(&Page{}).Scopes(RunScope(runID)).Where("status_code > 0 AND total_millis > 0")
+
+	var totals []int64
+	if err := timed.Session(&gorm.Session{}).Order("total_millis").Pluck("total_millis", &totals).Error; err != nil {
+		return err
+	}
+	var agg struct {
+		AvgTTFB  float64
+		AvgBody  float64
+		BodySize int64
+	}
+	err := timed.Session(&gorm.Session{}).Select(`
+		COALESCE(AVG(ttfb_millis), 0) AS avg_ttfb,
+		COALESCE(AVG(body_bytes), 0) AS avg_body,
+		COALESCE(SUM(body_bytes), 0) AS body_size`).
+		Scan(&agg).Error
+	if err != nil {
+		return err
+	}
+
+	stats.TimedPages = len(totals)
+	if len(totals) == 0 {
+		return nil
+	}
+	var sum int64
+	for _, ms := range totals {
+		sum += ms
+	}
+	stats.AvgResponseMillis = sum / int64(len(totals))
+	stats.P50ResponseMillis = percentile(totals, 50)
+	stats.P90ResponseMillis = percentile(totals, 90)
+	stats.P99ResponseMillis = percentile(totals, 99)
+	stats.MaxResponseMillis = totals[len(totals)-1]
+	stats.AvgTTFBMillis = int64(agg.AvgTTFB)
+	stats.AvgBodyBytes = int64(agg.AvgBody)
+	stats.TotalBodyBytes = agg.BodySize
+	return nil
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values.
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
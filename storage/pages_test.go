@@ -0,0 +1,50 @@
+package storage
+
+import "testing"
+
+func TestUpdateInboundLinks(t *testing.T) {
+	db, err := Open(MemoryDB, Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const run = "run-1"
+	pages := []Page{
+		{RunID: run, URL: "https://example.com/"},
+		{RunID: run, URL: "https://example.com/a"},
+		{RunID: run, URL: "https://blog.example.com/"},
+		{RunID: "run-0", URL: "https://example.com/a"},
+	}
+	if err := db.Create(&pages).Error; err != nil {
+		t.Fatal(err)
+	}
+	edges := []Edge{
+		{RunID: run, FromURL: "https://example.com/", ToURL: "https://example.com/a", Internal: true},
+		{RunID: run, FromURL: "https://example.com/", ToURL: "https://example.com/a", Internal: true},
+		{RunID: run, FromURL: "https://blog.example.com/", ToURL: "https://example.com/a", Internal: false},
+		{RunID: run, FromURL: "https://example.com/a", ToURL: "https://example.com/a", Internal: true},
+		{RunID: "run-0", FromURL: "https://example.com/", ToURL: "https://example.com/a", Internal: true},
+	}
+	if err := db.Create(&edges).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateInboundLinks(db, run); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{
+		"https://example.com/":      0,
+		"https://example.com/a":     1, // the blog's link is external, the self-link doesn't count
+		"https://blog.example.com/": 0,
+	}
+	var got []Page
+	if err := db.Scopes(RunScope(run)).Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range got {
+		if p.InboundLinks != want[p.URL] {
+			t.Errorf("InboundLinks of %s = %d, want %d", p.URL, p.InboundLinks, want[p.URL])
+		}
+	}
+}
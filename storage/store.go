@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// STORAGE
+// ============================================================================
+
+// Storage is where a crawl keeps its pages, their links and its stats.
+// The crawler saves and looks up pages, details and links only through
+// it, so -hash-gate and -revalidate work on any Storage. The bookkeeping
+// of the run (crawl numbering, the -stream frontier, host budgets, API
+// records, -autotune samples), the aggregates computed once it ends and
+// the reports run on the database DB returns.
+type Storage interface {
+	// SavePage stores page, see UpsertPage, and replaces the details
+	// stored with it before by details. page.ID is set to the stored row.
+	SavePage(page *Page, details PageDetails, mode string) error
+
+	// SaveEdges stores the links found on a page.
+	SaveEdges(edges []Edge) error
+
+	// PreviousPage returns the latest page stored for url by a run other
+	// than runID that has a content hash, or nil if there is none.
+	PreviousPage(runID, url string) (*Page, error)
+
+	// Details returns the details stored with the page pageID.
+	Details(pageID uint) (PageDetails, error)
+
+	// EdgesFrom returns the links stored by runID for the page fromURL,
+	// in the order they were found.
+	EdgesFrom(runID, fromURL string) ([]Edge, error)
+
+	// SaveStats inserts the stats row of a run, or updates it once it has
+	// an ID.
+	SaveStats(stats *CrawlStats) error
+
+	// HasURL reports whether runID has a page stored for url.
+	HasURL(runID, url string) (bool, error)
+
+	// Transaction runs fn with a Storage whose writes are committed
+	// together when fn returns nil, and rolled back otherwise.
+	Transaction(fn func(tx Storage) error) error
+
+	// DB returns the underlying database.
+	DB() *gorm.DB
+}
+
+// PageDetails are the rows stored alongside a page. Their IDs and PageIDs
+// are set by SavePage.
+type PageDetails struct {
+	Resources   []Resource
+	Headings    []Heading
+	AnchorLinks []AnchorLink
+}
+
+// gormStorage stores into a database opened with Open: SQLite, Postgres
+// or MySQL.
+type gormStorage struct {
+	db *gorm.DB
+}
+
+// New returns the Storage of a database opened with Open.
+func New(db *gorm.DB) Storage {
+	return gormStorage{db: db}
+}
+
+func (s gormStorage) SavePage(page *Page, details PageDetails, mode string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := UpsertPage(tx, page, mode); err != nil {
+			return err
+		}
+		if err := ClearPageDetails(tx, page.ID); err != nil {
+			return err
+		}
+
+		for i := range details.Resources {
+			details.Resources[i].ID, details.Resources[i].PageID = 0, page.ID
+		}
+		for i := range details.Headings {
+			details.Headings[i].ID, details.Headings[i].PageID = 0, page.ID
+		}
+		for i := range details.AnchorLinks {
+			details.AnchorLinks[i].ID, details.AnchorLinks[i].PageID = 0, page.ID
+		}
+		if len(details.Resources) > 0 {
+			if err := tx.CreateInBatches(details.Resources, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(details.Headings) > 0 {
+			if err := tx.CreateInBatches(details.Headings, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(details.AnchorLinks) > 0 {
+			return tx.CreateInBatches(details.AnchorLinks, 100).Error
+		}
+		return nil
+	})
+}
+
+func (s gormStorage) SaveEdges(edges []Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(&edges, 100).Error
+}
+
+func (s gormStorage) PreviousPage(runID, url string) (*Page, error) {
+	var page Page
+	err := s.db.Where("url = ? AND run_id <> ? AND content_hash <> ''", url, runID).
+		Order("crawled_at DESC").
+		First(&page).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s gormStorage) Details(pageID uint) (PageDetails, error) {
+	var details PageDetails
+	if err := s.db.Where("page_id = ?", pageID).Find(&details.Resources).Error; err != nil {
+		return PageDetails{}, err
+	}
+	if err := s.db.Where("page_id = ?", pageID).Find(&details.Headings).Error; err != nil {
+		return PageDetails{}, err
+	}
+	if err := s.db.Where("page_id = ?", pageID).Find(&details.AnchorLinks).Error; err != nil {
+		return PageDetails{}, err
+	}
+	return details, nil
+}
+
+func (s gormStorage) EdgesFrom(runID, fromURL string) ([]Edge, error) {
+	var edges []Edge
+	err := s.db.Where("run_id = ? AND from_url = ?", runID, fromURL).
+		Order("id").
+		Find(&edges).Error
+	return edges, err
+}
+
+func (s gormStorage) SaveStats(stats *CrawlStats) error {
+	return s.db.Save(stats).Error
+}
+
+func (s gormStorage) HasURL(runID, url string) (bool, error) {
+	var count int64
+	err := s.db.Model(&Page{}).
+		Where("run_id = ? AND url_hash = ?", runID, URLHash(url)).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s gormStorage) Transaction(fn func(tx Storage) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(gormStorage{db: tx})
+	})
+}
+
+func (s gormStorage) DB() *gorm.DB {
+	return s.db
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSavePageLongURLs(t *testing.T) {
+	db, err := Open(MemoryDB, Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := New(db)
+
+	// The URLs share their first 600 characters, more than MySQL could
+	// index of the URL itself.
+	prefix := "https://example.com/" + strings.Repeat("a", 600)
+	urls := []string{prefix + "/one", prefix + "/two"}
+	for _, url := range urls {
+		for range 2 { // saved again, as by a resumed run
+			page := Page{RunID: "run-1", URL: url, Title: url[len(prefix):]}
+			if err := store.SavePage(&page, PageDetails{}, RecrawlHistory); err != nil {
+				t.Fatal(err)
+			}
+			if page.ID == 0 {
+				t.Fatalf("SavePage left the ID of %s unset", url[len(prefix):])
+			}
+		}
+	}
+
+	var pages []Page
+	if err := db.Scopes(RunScope("run-1")).Order("url").Find(&pages).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("stored %d pages, want 2", len(pages))
+	}
+	for i, p := range pages {
+		if p.URL != urls[i] || p.URLHash != URLHash(urls[i]) {
+			t.Errorf("page %d = %s with hash %s, want %s with hash %s", i, p.URL[len(prefix):], p.URLHash, urls[i][len(prefix):], URLHash(urls[i]))
+		}
+	}
+
+	for _, tt := range []struct {
+		runID, url string
+		want       bool
+	}{
+		{"run-1", urls[0], true},
+		{"run-1", urls[1], true},
+		{"run-1", prefix + "/three", false},
+		{"run-2", urls[0], false},
+	} {
+		got, err := store.HasURL(tt.runID, tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("HasURL(%s, ...%s) = %v, want %v", tt.runID, tt.url[len(prefix):], got, tt.want)
+		}
+	}
+}
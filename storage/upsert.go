@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// PAGE UPSERTS
+// ============================================================================
+
+// -on-recrawl modes.
+const (
+	RecrawlHistory = "history" // one row per run and URL; earlier runs are kept
+	RecrawlUpdate  = "update"  // one row per URL, overwritten by each run
+)
+
+var RecrawlModes = []string{RecrawlHistory, RecrawlUpdate}
+
+// UpsertPage stores page, replacing the row its run already has for its
+// URL, so a page saved twice (a resumed run, a retry after a failure)
+// keeps the latest data. In RecrawlUpdate mode it replaces the URL's row
+// from any earlier run instead, moving it into page's run, and sets the
+// page's ChangeStatus against the row it replaces, as that row is gone
+// afterwards. page.ID is set to the stored row.
+//
+// The resources, headings and anchor links of a replaced row are left
+// alone; callers storing new ones clear them with ClearPageDetails.
+func UpsertPage(db *gorm.DB, page *Page, mode string) error {
+	if mode == RecrawlUpdate {
+		var existing Page
+		err := db.Select("id", "created_at", "run_id", "text_hash", "status_code", "change_status").
+			Where("url = ?", page.URL).
+			Order("crawled_at DESC").
+			First(&existing).Error
+		if err == nil {
+			page.ID, page.CreatedAt = existing.ID, existing.CreatedAt
+			switch {
+			case existing.RunID == page.RunID:
+				page.ChangeStatus = existing.ChangeStatus // saved again by the same run
+			case existing.TextHash == page.TextHash && existing.StatusCode == page.StatusCode:
+				page.ChangeStatus = ChangeUnchanged
+			default:
+				page.ChangeStatus = ChangeChanged
+			}
+			return db.Save(page).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "run_id"}, {Name: "url_hash"}},
+		UpdateAll: true,
+	}).Create(page).Error
+	if err != nil || db.Dialector.Name() != "mysql" {
+		return err
+	}
+	// MySQL doesn't return the ID of a row the upsert updated.
+	return db.Model(&Page{}).
+		Where("run_id = ? AND url_hash = ?", page.RunID, page.URLHash).
+		Select("id").
+		Scan(&page.ID).Error
+}
+
+// ClearPageDetails deletes the resources, headings and anchor links
+// stored for a page, before they are saved again.
+func ClearPageDetails(db *gorm.DB, pageID uint) error {
+	for _, model := range []any{&Resource{}, &Heading{}, &AnchorLink{}} {
+		if err := db.Where("page_id = ?", pageID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}